@@ -0,0 +1,89 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Bookmark represents article saved by the user for later reading
+type Bookmark struct {
+	ID     int64
+	UserID int64
+	Feed   string
+	Title  string
+	URI    string
+	Date   *time.Time
+	Added  *time.Time
+}
+
+// AddBookmark saves feed item for the user, returns false when it was already saved
+func (db *Postgres) AddBookmark(userID int64, item FeedItem) (bool, error) {
+	query := `INSERT INTO bookmarks (user_id, feed, title, uri, date) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id, uri) DO NOTHING`
+	tag, err := db.Pool.Exec(db.Context, query, userID, item.Feed, item.Title, item.URI, item.Date)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetBookmarks returns page of user bookmarks in saving order and total number of bookmarks
+func (db *Postgres) GetBookmarks(userID int64, offset int, count int) ([]Bookmark, int, error) {
+	query := `SELECT id, user_id, feed, title, uri, date, added, COUNT(*) OVER () FROM bookmarks
+	WHERE user_id = $1
+	ORDER BY id
+	OFFSET $2 LIMIT $3`
+
+	rows, err := db.Pool.Query(db.Context, query, userID, offset, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var items []Bookmark
+	var total int
+	for rows.Next() {
+		var item Bookmark
+		if err = rows.Scan(&item.ID, &item.UserID, &item.Feed, &item.Title, &item.URI, &item.Date, &item.Added, &total); err != nil {
+			return items, total, err
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return items, total, err
+	}
+
+	// Window count is unknown when the page is out of range
+	if len(items) == 0 && offset > 0 {
+		err = db.Pool.QueryRow(db.Context, `SELECT COUNT(*) FROM bookmarks WHERE user_id = $1`, userID).Scan(&total)
+	}
+
+	return items, total, err
+}
+
+// DeleteBookmark removes user bookmark by its position in saving order, returns nil when there is no such bookmark
+func (db *Postgres) DeleteBookmark(userID int64, position int) (*Bookmark, error) {
+	if position < 1 {
+		return nil, nil
+	}
+
+	query := `DELETE FROM bookmarks WHERE id = (
+		SELECT id FROM bookmarks WHERE user_id = $1 ORDER BY id OFFSET $2 LIMIT 1
+	)
+	RETURNING id, user_id, feed, title, uri, date, added`
+
+	var item Bookmark
+	err := db.Pool.QueryRow(db.Context, query, userID, position-1).Scan(&item.ID, &item.UserID, &item.Feed, &item.Title, &item.URI, &item.Date, &item.Added)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Channel represents Telegram channel linked by its administrator to receive feed updates
+type Channel struct {
+	ChatID  int64
+	OwnerID int64
+	Name    string
+	Added   *time.Time
+}
+
+// AddChannel links channel to the owner, channel can be linked to a single owner at a time
+func (db *Postgres) AddChannel(channel Channel) error {
+	query := `INSERT INTO channels (chat_id, owner_id, name) VALUES ($1, $2, $3)
+	ON CONFLICT (chat_id) DO UPDATE SET owner_id = $2, name = $3`
+	_, err := db.Pool.Exec(db.Context, query, channel.ChatID, channel.OwnerID, channel.Name)
+	return err
+}
+
+// GetChannels returns channels linked by the owner
+func (db *Postgres) GetChannels(ownerID int64) ([]Channel, error) {
+	query := `SELECT chat_id, owner_id, name, added FROM channels WHERE owner_id = $1 ORDER BY added`
+	rows, err := db.Pool.Query(db.Context, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []Channel
+	for rows.Next() {
+		var channel Channel
+		if err = rows.Scan(&channel.ChatID, &channel.OwnerID, &channel.Name, &channel.Added); err != nil {
+			return channels, err
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
+// GetChannel reads owner channel by its name, returns nil when channel is not linked
+func (db *Postgres) GetChannel(ownerID int64, name string) (*Channel, error) {
+	query := `SELECT chat_id, owner_id, name, added FROM channels WHERE owner_id = $1 AND lower(name) = lower($2)`
+
+	var channel Channel
+	err := db.Pool.QueryRow(db.Context, query, ownerID, name).Scan(&channel.ChatID, &channel.OwnerID, &channel.Name, &channel.Added)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &channel, nil
+}
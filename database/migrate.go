@@ -0,0 +1,229 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// migrationLock is an advisory lock key to run migrations from single instance at a time
+const migrationLock = 4412197713
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// MigrationStatus represents schema version and the date it was applied
+type MigrationStatus struct {
+	Version int
+	Name    string
+	Applied *time.Time
+}
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrateUp applies all pending migrations and returns number of applied ones
+func (db *Postgres) MigrateUp() (int, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = db.withMigrations(func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+
+			err := db.runMigration(conn, m.up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed, %s", m.version, m.name, err)
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// MigrateDownTo reverts applied migrations with version greater than specified one and returns number of reverted ones
+func (db *Postgres) MigrateDownTo(version int) (int, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = db.withMigrations(func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok || m.version <= version {
+				continue
+			}
+
+			if len(m.down) == 0 {
+				return fmt.Errorf("migration %04d_%s can't be reverted", m.version, m.name)
+			}
+
+			err := db.runMigration(conn, m.down, `DELETE FROM schema_migrations WHERE version = $1`, m.version)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s revert failed, %s", m.version, m.name, err)
+			}
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// MigrationStatus returns all known migrations, pending ones have no applied date
+func (db *Postgres) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var rst []MigrationStatus
+	err = db.withMigrations(func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for _, m := range migrations {
+			status := MigrationStatus{Version: m.version, Name: m.name}
+			if at, ok := applied[m.version]; ok {
+				status.Applied = &at
+			}
+			rst = append(rst, status)
+		}
+
+		return nil
+	})
+
+	return rst, err
+}
+
+// withMigrations holds advisory lock on dedicated connection and reads applied migrations
+func (db *Postgres) withMigrations(fn func(conn *pgxpool.Conn, applied map[int]time.Time) error) error {
+	conn, err := db.Pool.Acquire(db.Context)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(db.Context, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(db.Context, `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations(
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err = conn.Exec(db.Context, query); err != nil {
+		return err
+	}
+
+	rows, err := conn.Query(db.Context, `SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return err
+		}
+		applied[version] = at
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+// runMigration executes migration script and updates versions table within single transaction
+func (db *Postgres) runMigration(conn *pgxpool.Conn, script string, track string, args ...interface{}) error {
+	tx, err := conn.Begin(db.Context)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(db.Context)
+
+	if _, err = tx.Exec(db.Context, script); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(db.Context, track, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(db.Context)
+}
+
+// loadMigrations reads migration scripts ordered by version, every version must have up script
+func loadMigrations(src fs.FS) ([]migration, error) {
+	files, err := fs.Glob(src, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]*migration)
+	for _, file := range files {
+		parts := migrationName.FindStringSubmatch(path.Base(file))
+		if parts == nil {
+			return nil, fmt.Errorf("unexpected migration file name '%s'", file)
+		}
+
+		version, _ := strconv.Atoi(parts[1])
+		m, ok := known[version]
+		if !ok {
+			m = &migration{version: version, name: parts[2]}
+			known[version] = m
+		} else if m.name != parts[2] {
+			return nil, fmt.Errorf("migration %04d has different names '%s' and '%s'", version, m.name, parts[2])
+		}
+
+		raw, err := fs.ReadFile(src, file)
+		if err != nil {
+			return nil, err
+		}
+
+		if parts[3] == "up" {
+			m.up = string(raw)
+		} else {
+			m.down = string(raw)
+		}
+	}
+
+	var rst []migration
+	for _, m := range known {
+		if len(m.up) == 0 {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.version, m.name)
+		}
+		rst = append(rst, *m)
+	}
+
+	sort.Slice(rst, func(i, j int) bool { return rst[i].version < rst[j].version })
+	return rst, nil
+}
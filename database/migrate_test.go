@@ -0,0 +1,62 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	rst, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("Error not expected, but was: %s", err)
+	}
+
+	for i, m := range rst {
+		if m.version != i+1 {
+			t.Errorf("Expected version %d, but was %d", i+1, m.version)
+		}
+
+		if len(m.down) == 0 {
+			t.Errorf("Expected down script for %04d_%s", m.version, m.name)
+		}
+	}
+}
+
+func TestLoadMigrations_Ordered(t *testing.T) {
+	src := fstest.MapFS{
+		"migrations/0010_last.up.sql":  {Data: []byte("3")},
+		"migrations/0002_next.up.sql":  {Data: []byte("2")},
+		"migrations/0001_first.up.sql": {Data: []byte("1")},
+	}
+
+	rst, err := loadMigrations(src)
+	if err != nil {
+		t.Fatalf("Error not expected, but was: %s", err)
+	}
+
+	if len(rst) != 3 || rst[0].name != "first" || rst[1].name != "next" || rst[2].version != 10 {
+		t.Errorf("Expected ordered migrations, but was %v", rst)
+	}
+}
+
+func TestLoadMigrations_NoUpScript(t *testing.T) {
+	src := fstest.MapFS{
+		"migrations/0001_first.down.sql": {Data: []byte("1")},
+	}
+
+	_, err := loadMigrations(src)
+	if err == nil || !strings.Contains(err.Error(), "no up script") {
+		t.Errorf("Expected missing up script error, but was %v", err)
+	}
+}
+
+func TestLoadMigrations_WrongName(t *testing.T) {
+	src := fstest.MapFS{
+		"migrations/first.sql": {Data: []byte("1")},
+	}
+
+	if _, err := loadMigrations(src); err == nil {
+		t.Errorf("Expected error on unexpected file name")
+	}
+}
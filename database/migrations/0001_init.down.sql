@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS userfeeds;
+DROP TABLE IF EXISTS feeds;
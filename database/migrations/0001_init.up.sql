@@ -1,15 +1,14 @@
-CREATE TABLE feeds(
-	id SERIAL PRIMARY KEY,
-	name VARCHAR (255) NOT NULL,
+CREATE TABLE IF NOT EXISTS feeds(
+  id SERIAL PRIMARY KEY,
+  name VARCHAR (255) NOT NULL,
   normalized VARCHAR (255) NOT NULL,
-	uri VARCHAR (512) UNIQUE NOT NULL,
+  uri VARCHAR (512) UNIQUE NOT NULL,
   updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   healthy BOOLEAN NOT NULL DEFAULT TRUE,
-  last_pub TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  last_pub_uri VARCHAR(1024) DEFAULT ''
+  last_pub TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE userfeeds(
+CREATE TABLE IF NOT EXISTS userfeeds(
     user_id BIGINT NOT NULL,
     feed_id INTEGER NOT NULL,
     added TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
@@ -19,4 +18,4 @@ CREATE TABLE userfeeds(
     CONSTRAINT userfeeds_feed_fk FOREIGN KEY (feed_id)
       REFERENCES feeds (id) MATCH SIMPLE
       ON UPDATE NO ACTION ON DELETE NO ACTION
-);
\ No newline at end of file
+);
@@ -0,0 +1 @@
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS last_pub_uri VARCHAR(1024) DEFAULT '';
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS feed_items;
+
+ALTER TABLE feeds
+  DROP COLUMN IF EXISTS etag,
+  DROP COLUMN IF EXISTS last_modified,
+  DROP COLUMN IF EXISTS next_check,
+  DROP COLUMN IF EXISTS check_interval,
+  DROP COLUMN IF EXISTS failures,
+  DROP COLUMN IF EXISTS last_error,
+  DROP COLUMN IF EXISTS disabled,
+  DROP COLUMN IF EXISTS link;
@@ -0,0 +1,23 @@
+ALTER TABLE feeds
+  ADD COLUMN IF NOT EXISTS etag VARCHAR(255) DEFAULT '',
+  ADD COLUMN IF NOT EXISTS last_modified VARCHAR(255) DEFAULT '',
+  ADD COLUMN IF NOT EXISTS next_check TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS check_interval INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS failures INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS last_error VARCHAR(1024) DEFAULT '',
+  ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN IF NOT EXISTS link VARCHAR(1024) DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS feed_items(
+    feed_id INTEGER NOT NULL,
+    guid TEXT NOT NULL,
+    seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (feed_id, guid),
+
+    CONSTRAINT feed_items_feed_fk FOREIGN KEY (feed_id)
+      REFERENCES feeds (id) MATCH SIMPLE
+      ON UPDATE NO ACTION ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS feed_items_seen_idx ON feed_items (seen);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS digest_items;
+DROP TABLE IF EXISTS users;
+
+ALTER TABLE userfeeds
+  DROP COLUMN IF EXISTS filters,
+  DROP COLUMN IF EXISTS category;
@@ -0,0 +1,23 @@
+ALTER TABLE userfeeds
+  ADD COLUMN IF NOT EXISTS filters TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS category VARCHAR(256) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS users(
+    user_id BIGINT PRIMARY KEY,
+    lang VARCHAR(8) NOT NULL DEFAULT '',
+    digest VARCHAR(16) NOT NULL DEFAULT 'instant',
+    digest_at INTEGER NOT NULL DEFAULT 0,
+    last_digest TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS digest_items(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    feed VARCHAR(255) NOT NULL,
+    title TEXT NOT NULL,
+    uri VARCHAR(1024) NOT NULL,
+    date TIMESTAMPTZ,
+    added TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS digest_items_user_idx ON digest_items (user_id);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS bookmarks;
+
+ALTER TABLE feed_items
+  DROP COLUMN IF EXISTS title,
+  DROP COLUMN IF EXISTS uri;
+
+ALTER TABLE userfeeds DROP COLUMN IF EXISTS muted_until;
@@ -0,0 +1,16 @@
+ALTER TABLE userfeeds ADD COLUMN IF NOT EXISTS muted_until TIMESTAMPTZ;
+
+ALTER TABLE feed_items
+  ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS uri VARCHAR(1024) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS bookmarks(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    feed VARCHAR(255) NOT NULL,
+    title TEXT NOT NULL,
+    uri VARCHAR(1024) NOT NULL,
+    added TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE (user_id, uri)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE bookmarks DROP COLUMN IF EXISTS date;
+
+ALTER TABLE feed_items DROP COLUMN IF EXISTS date;
@@ -0,0 +1,3 @@
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS date TIMESTAMPTZ;
+
+ALTER TABLE bookmarks ADD COLUMN IF NOT EXISTS date TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE userfeeds RENAME COLUMN paused_until TO muted_until;
@@ -0,0 +1 @@
+ALTER TABLE userfeeds RENAME COLUMN muted_until TO paused_until;
@@ -0,0 +1,7 @@
+ALTER TABLE outbox DROP COLUMN IF EXISTS silent;
+
+ALTER TABLE users
+  DROP COLUMN IF EXISTS timezone,
+  DROP COLUMN IF EXISTS quiet_mode,
+  DROP COLUMN IF EXISTS quiet_from,
+  DROP COLUMN IF EXISTS quiet_to;
@@ -0,0 +1,7 @@
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS quiet_mode VARCHAR(16) NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS quiet_from INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS quiet_to INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS silent BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS channels(
+    chat_id BIGINT PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    added TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS channels_owner_idx ON channels (owner_id);
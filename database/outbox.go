@@ -0,0 +1,111 @@
+package database
+
+import (
+	"time"
+)
+
+// OutboxMessage represents outgoing message waiting for delivery
+type OutboxMessage struct {
+	ID       int64
+	ChatID   int64
+	Text     string
+	Markup   string
+	Silent   bool
+	Attempts int
+}
+
+// AddOutbox inserts new pending message to outbox postgres table, silent messages are sent without notification
+func (db *Postgres) AddOutbox(chatID int64, text string, markup string, silent bool) error {
+	query := `INSERT INTO outbox (chat_id, text, markup, silent) VALUES ($1, $2, $3, $4)`
+	_, err := db.Pool.Exec(db.Context, query, chatID, text, markup, silent)
+	return err
+}
+
+// GetOutbox read specified count of pending messages due for delivery, messages of skipped chats are not read.
+// Messages are ordered round-robin between chats, so one chat can't hold up others.
+func (db *Postgres) GetOutbox(count int, skip []int64) ([]OutboxMessage, error) {
+	if skip == nil {
+		skip = []int64{}
+	}
+
+	query := `SELECT id, chat_id, text, markup, silent, attempts FROM (
+		SELECT id, chat_id, text, markup, silent, attempts, ROW_NUMBER() OVER (PARTITION BY chat_id ORDER BY id) AS turn
+		FROM outbox
+		WHERE status = 'pending' AND next_retry <= CURRENT_TIMESTAMP AND chat_id <> ALL($2)
+	) o
+	ORDER BY turn, id
+	LIMIT $1`
+
+	rows, err := db.Pool.Query(db.Context, query, count, skip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		if err = rows.Scan(&msg.ID, &msg.ChatID, &msg.Text, &msg.Markup, &msg.Silent, &msg.Attempts); err != nil {
+			return msgs, err
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, rows.Err()
+}
+
+// SetOutboxSent marks message as delivered
+func (db *Postgres) SetOutboxSent(id int64) error {
+	query := `UPDATE outbox
+	SET status = 'sent',
+	attempts = attempts + 1,
+	last_error = '',
+	updated = CURRENT_TIMESTAMP
+	WHERE id = $1`
+
+	_, err := db.Pool.Exec(db.Context, query, id)
+	return err
+}
+
+// SetOutboxRetry counts failed attempt and postpones next delivery
+func (db *Postgres) SetOutboxRetry(id int64, lastError string, retry time.Duration) error {
+	query := `UPDATE outbox
+	SET attempts = attempts + 1,
+	last_error = $1,
+	next_retry = CURRENT_TIMESTAMP + make_interval(secs => $2),
+	updated = CURRENT_TIMESTAMP
+	WHERE id = $3`
+
+	_, err := db.Pool.Exec(db.Context, query, cropError(lastError), retry.Seconds(), id)
+	return err
+}
+
+// SetOutboxFailed counts failed attempt and stops message delivery
+func (db *Postgres) SetOutboxFailed(id int64, lastError string) error {
+	query := `UPDATE outbox
+	SET status = 'failed',
+	attempts = attempts + 1,
+	last_error = $1,
+	updated = CURRENT_TIMESTAMP
+	WHERE id = $2`
+
+	_, err := db.Pool.Exec(db.Context, query, cropError(lastError), id)
+	return err
+}
+
+// DeleteOutbox removes delivered and failed messages completed before specified date
+func (db *Postgres) DeleteOutbox(before time.Time) error {
+	query := `DELETE FROM outbox WHERE status <> 'pending' AND updated < $1`
+	_, err := db.Pool.Exec(db.Context, query, before)
+	return err
+}
+
+// CountOutbox returns number of messages waiting for delivery
+func (db *Postgres) CountOutbox() (int, error) {
+	query := `SELECT COUNT(*) FROM outbox WHERE status = 'pending'`
+
+	var count int
+	err := db.Pool.QueryRow(db.Context, query).Scan(&count)
+	return count, err
+}
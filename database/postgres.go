@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -21,14 +22,30 @@ type Database interface {
 	// Close will termintae current connection, Should be called after all operations
 	Close()
 
+	// Ping checks database is reachable
+	Ping() error
+
 	// GetStats gets total number of users and feeds
 	GetStats() (*Stats, error)
 
 	// AddFeed inserts new feed to feeds postgres table
-	AddFeed(name string, normalized string, uri string) (*Feed, error)
+	AddFeed(name string, normalized string, uri string, link string) (*Feed, error)
+
+	// Subscribe bind relation between user and feed within category
+	Subscribe(userID int64, feedID int, category string) error
+
+	// SetFilters updates user subscription filter rules
+	SetFilters(userID int64, feedID int, filters []string) error
+
+	// Pause stops feed updates delivery to the user until specified date or until resume when date is empty.
+	// Zero feedID pauses all user subscriptions.
+	Pause(userID int64, feedID int, until *time.Time) error
 
-	// Subscribe bind relation between user and feed
-	Subscribe(userID int64, feedID int) error
+	// Mute stops feed updates delivery to the user until specified date, longer pause is kept
+	Mute(userID int64, feedID int, until time.Time) error
+
+	// Resume restores feed updates delivery to the user, zero feedID resumes all user subscriptions
+	Resume(userID int64, feedID int) error
 
 	// Unsubscribe unbind relation between user and feed
 	Unsubscribe(userID int64, feedID int) error
@@ -36,6 +53,54 @@ type Database interface {
 	// DeleteUser will delete all user records
 	DeleteUser(userID int64) error
 
+	// GetUser gets user settings, returns nil when user has default settings
+	GetUser(userID int64) (*User, error)
+
+	// SetUserLang updates user preferred language
+	SetUserLang(userID int64, lang string) error
+
+	// SetUserTimezone updates user timezone name
+	SetUserTimezone(userID int64, timezone string) error
+
+	// SetUserQuiet updates user quiet hours
+	SetUserQuiet(userID int64, quiet Quiet) error
+
+	// SetUserDigest updates user digest mode and minute of the day for daily digest
+	SetUserDigest(userID int64, digest string, digestAt int) error
+
+	// SetUserDigested updates date of the last sent digest
+	SetUserDigested(userID int64, at time.Time) error
+
+	// AddDigestItem queues article for the user digest
+	AddDigestItem(item DigestItem) error
+
+	// GetDigestUsers returns settings of the users with queued articles
+	GetDigestUsers() ([]User, error)
+
+	// GetDigestItems returns queued articles of the user ordered by feed
+	GetDigestItems(userID int64) ([]DigestItem, error)
+
+	// DeleteDigestItems removes sent articles from the user digest queue
+	DeleteDigestItems(userID int64, ids []int64) error
+
+	// AddChannel links channel to the owner, channel can be linked to a single owner at a time
+	AddChannel(channel Channel) error
+
+	// GetChannels returns channels linked by the owner
+	GetChannels(ownerID int64) ([]Channel, error)
+
+	// GetChannel reads owner channel by its name, returns nil when channel is not linked
+	GetChannel(ownerID int64, name string) (*Channel, error)
+
+	// AddBookmark saves feed item for the user, returns false when it was already saved
+	AddBookmark(userID int64, item FeedItem) (bool, error)
+
+	// GetBookmarks returns page of user bookmarks in saving order and total number of bookmarks
+	GetBookmarks(userID int64, offset int, count int) ([]Bookmark, int, error)
+
+	// DeleteBookmark removes user bookmark by its position in saving order, returns nil when there is no such bookmark
+	DeleteBookmark(userID int64, position int) (*Bookmark, error)
+
 	// GetUserFeeds gets user subscriptions
 	GetUserFeeds(userID int64) ([]Feed, error)
 
@@ -45,33 +110,102 @@ type Database interface {
 	// GetUserNormalizedFeed get user subscription by its normalized name
 	GetUserNormalizedFeed(userID int64, normalized string) (*Feed, error)
 
+	// GetUserIDFeed get user subscription by feed id
+	GetUserIDFeed(userID int64, feedID int) (*Feed, error)
+
 	// GetFeed get feed record by its uri (unique)
 	GetFeed(uri string) (*Feed, error)
 
-	// GetFeeds read specified count for update
+	// GetFeeds read specified count of feeds due for update
 	GetFeeds(count int) ([]Feed, error)
 
-	// GetFeedUsers returns active feed subscriptions
+	// GetFeedUsers returns active feed subscriptions, paused ones are skipped
 	GetFeedUsers(feedID int) ([]UserFeed, error)
 
-	// GetAllUsers returns all unique user IDs who have subscribed to feeds
-	GetAllUsers() ([]int64, error)
+	// GetAllUsers returns all unique users who have subscribed to feeds, channels are skipped
+	GetAllUsers() ([]User, error)
 
-	// ResetFeed updates feed dates to prevent spam to first subscription after some time
+	// ResetFeed updates feed dates, drops items history and failures to prevent spam to first subscription after some time
 	ResetFeed(feedID int) error
 
-	// SetFeedUpdated update feed by new timespan and set healthy to true
+	// GetNewFeedItems returns guids which were not seen before
+	GetNewFeedItems(feedID int, guids []string) ([]string, error)
+
+	// HasFeedItems checks if feed has items history
+	HasFeedItems(feedID int) (bool, error)
+
+	// AddFeedItems stores feed items history
+	AddFeedItems(feedID int, items []FeedItem) error
+
+	// GetFeedItem reads feed item by its short key
+	GetFeedItem(feedID int, key string) (*FeedItem, error)
+
+	// GetFeedItems returns latest stored feed items, newest first
+	GetFeedItems(feedID int, count int) ([]FeedItem, error)
+
+	// GetUserURIFeedItem reads feed item by its uri among user subscriptions
+	GetUserURIFeedItem(userID int64, uri string) (*FeedItem, error)
+
+	// DeleteFeedItems removes items history which was not seen since specified date
+	DeleteFeedItems(before time.Time) error
+
+	// AddOutbox inserts new pending message to outbox postgres table, silent messages are sent without notification
+	AddOutbox(chatID int64, text string, markup string, silent bool) error
+
+	// GetOutbox read specified count of pending messages due for delivery, ordered round-robin between chats, skipped chats are not read
+	GetOutbox(count int, skip []int64) ([]OutboxMessage, error)
+
+	// SetOutboxSent marks message as delivered
+	SetOutboxSent(id int64) error
+
+	// SetOutboxRetry counts failed attempt and postpones next delivery
+	SetOutboxRetry(id int64, lastError string, retry time.Duration) error
+
+	// SetOutboxFailed counts failed attempt and stops message delivery
+	SetOutboxFailed(id int64, lastError string) error
+
+	// DeleteOutbox removes delivered and failed messages completed before specified date
+	DeleteOutbox(before time.Time) error
+
+	// CountOutbox returns number of messages waiting for delivery
+	CountOutbox() (int, error)
+
+	// SetFeedUpdated update feed by new timespan, set healthy to true and reset failures
 	SetFeedUpdated(id int) error
 
-	// SetFeedLastPub update feed by new timespan, set healthy to true and set last publication date and URI
+	// SetFeedLastPub update feed by new timespan, set healthy to true, reset failures and set last publication date and URI
 	SetFeedLastPub(id int, lastPub time.Time, lastPubURI string) error
 
-	// SetFeedBroken update feed by setting healthy to false
-	SetFeedBroken(id int) error
+	// SetFeedSchedule update feed polling interval and next check date
+	SetFeedSchedule(id int, interval time.Duration) error
+
+	// SetFeedCache update feed conditional request validators
+	SetFeedCache(id int, etag string, lastModified string) error
+
+	// SetFeedBroken update feed by setting healthy to false, counting failure and postponing next check
+	SetFeedBroken(id int, lastError string, retry time.Duration) error
+
+	// DisableFeed update feed by setting healthy to false and excluding it from regular reading, feed is probed again after retry
+	DisableFeed(id int, lastError string, retry time.Duration) error
 }
 
-// Open will start database connection. Should be called first
+// Open will start database connection and apply pending migrations. Should be called first
 func Open(ctx context.Context, connection string) (*Postgres, error) {
+	db, err := Connect(ctx, connection)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = db.MigrateUp(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error while migrating database, %s", err)
+	}
+
+	return db, nil
+}
+
+// Connect will start database connection without migrations
+func Connect(ctx context.Context, connection string) (*Postgres, error) {
 	pctx, cancel := context.WithCancel(ctx)
 	pool, err := pgxpool.Connect(pctx, connection)
 	if err != nil {
@@ -82,6 +216,13 @@ func Open(ctx context.Context, connection string) (*Postgres, error) {
 	return &Postgres{Pool: pool, Context: pctx, cancel: cancel}, nil
 }
 
+// Ping checks database is reachable
+func (db *Postgres) Ping() error {
+	ctx, cancel := context.WithTimeout(db.Context, 5*time.Second)
+	defer cancel()
+	return db.Pool.Ping(ctx)
+}
+
 // Close will drop psql connections
 func (db *Postgres) Close() {
 	db.cancel()
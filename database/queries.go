@@ -1,29 +1,68 @@
 package database
 
 import (
+	"crypto/md5"
 	"database/sql"
+	"encoding/hex"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v4"
 )
 
+// itemKeyLength is a number of md5 hex chars used as feed item key
+const itemKeyLength = 12
+
 // Feed represents feed db table structure
 type Feed struct {
-	ID         int
-	Name       string
-	Normalized string
-	URI        string
-	Updated    *time.Time
-	Healthy    bool
-	LastPub    *time.Time
-	LastPubURI string
+	ID            int
+	Name          string
+	Normalized    string
+	URI           string
+	Updated       *time.Time
+	Healthy       bool
+	LastPub       *time.Time
+	LastPubURI    string
+	ETag          string
+	LastModified  string
+	NextCheck     *time.Time
+	CheckInterval int
+	Failures      int
+	LastError     string
+	Disabled      bool
+	Link          string
+
+	// Filters, Category and pause are user subscription settings, set by user queries only.
+	// PausedUntil is empty when subscription is paused until resume.
+	Filters     []string
+	Category    string
+	Paused      bool
+	PausedUntil *time.Time
 }
 
 // UserFeed represents user subscription to the feed
 type UserFeed struct {
-	UserID int64
+	UserID   int64
+	FeedID   int
+	Added    *time.Time
+	Lang     string
+	Digest   string
+	Filters  []string
+	Timezone string
+	Quiet    Quiet
+
+	// ChannelOwner is a user who manages channel subscription, empty for private chats and groups
+	ChannelOwner int64
+}
+
+// FeedItem represents feed article known to the reader
+type FeedItem struct {
 	FeedID int
-	Added  *time.Time
+	Feed   string
+	GUID   string
+	Title  string
+	URI    string
+	Date   *time.Time
 }
 
 // Stats represents basic service statistics
@@ -52,9 +91,9 @@ func (db *Postgres) GetStats() (*Stats, error) {
 }
 
 // AddFeed inserts new feed to feeds postgres table
-func (db *Postgres) AddFeed(name string, normalized string, uri string) (*Feed, error) {
-	query := `INSERT INTO feeds (name, normalized, uri) VALUES ($1, $2, $3) ON CONFLICT (uri) DO NOTHING`
-	_, err := db.Pool.Exec(db.Context, query, name, normalized, uri)
+func (db *Postgres) AddFeed(name string, normalized string, uri string, link string) (*Feed, error) {
+	query := `INSERT INTO feeds (name, normalized, uri, link) VALUES ($1, $2, $3, $4) ON CONFLICT (uri) DO NOTHING`
+	_, err := db.Pool.Exec(db.Context, query, name, normalized, uri, link)
 	if err != nil {
 		return nil, err
 	}
@@ -62,9 +101,44 @@ func (db *Postgres) AddFeed(name string, normalized string, uri string) (*Feed,
 	return db.GetFeed(uri)
 }
 
-// Subscribe bind relation between user and feed
-func (db *Postgres) Subscribe(userID int64, feedID int) error {
-	query := `INSERT INTO userfeeds (user_id, feed_id) VALUES ($1, $2) ON CONFLICT (user_id, feed_id) DO NOTHING`
+// Subscribe bind relation between user and feed, empty category keeps existing one
+func (db *Postgres) Subscribe(userID int64, feedID int, category string) error {
+	query := `INSERT INTO userfeeds (user_id, feed_id, category) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, feed_id) DO UPDATE SET category = COALESCE(NULLIF(EXCLUDED.category, ''), userfeeds.category)`
+	_, err := db.Pool.Exec(db.Context, query, userID, feedID, category)
+	return err
+}
+
+// SetFilters updates user subscription filter rules
+func (db *Postgres) SetFilters(userID int64, feedID int, filters []string) error {
+	if filters == nil {
+		filters = []string{}
+	}
+
+	query := `UPDATE userfeeds SET filters = $1 WHERE user_id = $2 AND feed_id = $3`
+	_, err := db.Pool.Exec(db.Context, query, filters, userID, feedID)
+	return err
+}
+
+// Pause stops feed updates delivery to the user until specified date or until resume when date is empty.
+// Zero feedID pauses all user subscriptions.
+func (db *Postgres) Pause(userID int64, feedID int, until *time.Time) error {
+	query := `UPDATE userfeeds SET paused_until = COALESCE($1, 'infinity'::timestamptz)
+	WHERE user_id = $2 AND ($3 = 0 OR feed_id = $3)`
+	_, err := db.Pool.Exec(db.Context, query, until, userID, feedID)
+	return err
+}
+
+// Mute stops feed updates delivery to the user until specified date, longer pause is kept
+func (db *Postgres) Mute(userID int64, feedID int, until time.Time) error {
+	query := `UPDATE userfeeds SET paused_until = GREATEST(paused_until, $1) WHERE user_id = $2 AND feed_id = $3`
+	_, err := db.Pool.Exec(db.Context, query, until, userID, feedID)
+	return err
+}
+
+// Resume restores feed updates delivery to the user, zero feedID resumes all user subscriptions
+func (db *Postgres) Resume(userID int64, feedID int) error {
+	query := `UPDATE userfeeds SET paused_until = NULL WHERE user_id = $1 AND ($2 = 0 OR feed_id = $2)`
 	_, err := db.Pool.Exec(db.Context, query, userID, feedID)
 	return err
 }
@@ -78,16 +152,28 @@ func (db *Postgres) Unsubscribe(userID int64, feedID int) error {
 
 // DeleteUser will delete all user records
 func (db *Postgres) DeleteUser(userID int64) error {
-	query := `DELETE FROM userfeeds WHERE user_id = $1`
-	_, err := db.Pool.Exec(db.Context, query, userID)
-	return err
+	queries := []string{
+		`DELETE FROM userfeeds WHERE user_id = $1`,
+		`DELETE FROM digest_items WHERE user_id = $1`,
+		`DELETE FROM bookmarks WHERE user_id = $1`,
+		`DELETE FROM channels WHERE chat_id = $1`,
+		`DELETE FROM users WHERE user_id = $1`,
+	}
+
+	for _, query := range queries {
+		if _, err := db.Pool.Exec(db.Context, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // GetUserFeeds gets user subscriptions
 func (db *Postgres) GetUserFeeds(userID int64) ([]Feed, error) {
 	var feeds []Feed
 
-	query := `SELECT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri FROM userfeeds uf
+	query := `SELECT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri, f.etag, f.last_modified, f.next_check, f.check_interval, f.failures, f.last_error, f.disabled, f.link, uf.filters, uf.category, COALESCE(uf.paused_until > CURRENT_TIMESTAMP, FALSE), NULLIF(uf.paused_until, 'infinity') FROM userfeeds uf
 	INNER JOIN feeds f ON f.id = uf.feed_id
 	WHERE uf.user_id = $1
 	ORDER BY uf.added`
@@ -98,34 +184,45 @@ func (db *Postgres) GetUserFeeds(userID int64) ([]Feed, error) {
 		return feeds, err
 	}
 
-	return toFeeds(rows)
+	return toUserFeeds(rows)
 }
 
 // GetUserURIFeed get user subscription by its uri (unique)
 func (db *Postgres) GetUserURIFeed(userID int64, uri string) (*Feed, error) {
-	query := `SELECT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri FROM userfeeds uf
+	query := `SELECT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri, f.etag, f.last_modified, f.next_check, f.check_interval, f.failures, f.last_error, f.disabled, f.link, uf.filters, uf.category, COALESCE(uf.paused_until > CURRENT_TIMESTAMP, FALSE), NULLIF(uf.paused_until, 'infinity') FROM userfeeds uf
 	INNER JOIN feeds f ON f.id = uf.feed_id
 	WHERE uf.user_id = $1 AND f.uri = $2
 	LIMIT 1`
 
 	row := db.Pool.QueryRow(db.Context, query, userID, uri)
-	return toFeed(row)
+	return toUserFeed(row)
 }
 
 // GetUserNormalizedFeed get user subscription by its normalized name
 func (db *Postgres) GetUserNormalizedFeed(userID int64, normalized string) (*Feed, error) {
-	query := `SELECT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri FROM userfeeds uf
+	query := `SELECT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri, f.etag, f.last_modified, f.next_check, f.check_interval, f.failures, f.last_error, f.disabled, f.link, uf.filters, uf.category, COALESCE(uf.paused_until > CURRENT_TIMESTAMP, FALSE), NULLIF(uf.paused_until, 'infinity') FROM userfeeds uf
 	INNER JOIN feeds f ON f.id = uf.feed_id
 	WHERE uf.user_id = $1 AND f.normalized = $2
 	LIMIT 1`
 
 	row := db.Pool.QueryRow(db.Context, query, userID, normalized)
-	return toFeed(row)
+	return toUserFeed(row)
+}
+
+// GetUserIDFeed get user subscription by feed id
+func (db *Postgres) GetUserIDFeed(userID int64, feedID int) (*Feed, error) {
+	query := `SELECT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri, f.etag, f.last_modified, f.next_check, f.check_interval, f.failures, f.last_error, f.disabled, f.link, uf.filters, uf.category, COALESCE(uf.paused_until > CURRENT_TIMESTAMP, FALSE), NULLIF(uf.paused_until, 'infinity') FROM userfeeds uf
+	INNER JOIN feeds f ON f.id = uf.feed_id
+	WHERE uf.user_id = $1 AND f.id = $2
+	LIMIT 1`
+
+	row := db.Pool.QueryRow(db.Context, query, userID, feedID)
+	return toUserFeed(row)
 }
 
 // GetFeed get feed record by its uri (unique)
 func (db *Postgres) GetFeed(uri string) (*Feed, error) {
-	query := `SELECT id, name, normalized, uri, updated, healthy, last_pub, last_pub_uri
+	query := `SELECT id, name, normalized, uri, updated, healthy, last_pub, last_pub_uri, etag, last_modified, next_check, check_interval, failures, last_error, disabled, link
 	FROM feeds
 	WHERE uri = $1
 	LIMIT 1`
@@ -134,16 +231,16 @@ func (db *Postgres) GetFeed(uri string) (*Feed, error) {
 	return toFeed(row)
 }
 
-// GetFeeds read specified count for update
+// GetFeeds read specified count of feeds due for update
 func (db *Postgres) GetFeeds(count int) ([]Feed, error) {
 	var feeds []Feed
 
-	// Get healthy or unhealthy for last day
-	query := `SELECT DISTINCT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri
+	// Get due feeds, broken feeds are postponed by backoff and disabled ones are probed rarely
+	query := `SELECT DISTINCT f.id, f.name, f.normalized, f.uri, f.updated, f.healthy, f.last_pub, f.last_pub_uri, f.etag, f.last_modified, f.next_check, f.check_interval, f.failures, f.last_error, f.disabled, f.link
 	FROM feeds f
 	INNER JOIN userfeeds uf ON uf.feed_id = f.id 
-	WHERE f.healthy = TRUE OR f.updated < current_date
-	ORDER BY f.updated
+	WHERE f.next_check <= CURRENT_TIMESTAMP
+	ORDER BY f.next_check
 	LIMIT $1`
 
 	rows, err := db.Pool.Query(db.Context, query, count)
@@ -155,30 +252,191 @@ func (db *Postgres) GetFeeds(count int) ([]Feed, error) {
 	return toFeeds(rows)
 }
 
-// ResetFeed updates feed dates to prevent spam to first subscription after some time
+// ResetFeed updates feed dates, drops items history and failures to prevent spam to first subscription after some time.
+// Disabled feed is enabled again for the new subscription even when it has other subscribers.
 func (db *Postgres) ResetFeed(feedID int) error {
 	query := `UPDATE feeds 
 	SET updated = CURRENT_TIMESTAMP,
 	last_pub = current_timestamp,
 	last_pub_uri = '',
-	healthy = TRUE
+	healthy = TRUE,
+	failures = 0,
+	last_error = '',
+	disabled = FALSE,
+	next_check = CURRENT_TIMESTAMP
 	WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM userfeeds WHERE feed_id = $1)`
 	_, err := db.Pool.Exec(db.Context, query, feedID)
+	if err != nil {
+		return err
+	}
+
+	query = `DELETE FROM feed_items
+	WHERE feed_id = $1 AND NOT EXISTS (SELECT 1 FROM userfeeds WHERE feed_id = $1)`
+	_, err = db.Pool.Exec(db.Context, query, feedID)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE feeds
+	SET disabled = FALSE,
+	failures = 0,
+	next_check = CURRENT_TIMESTAMP
+	WHERE id = $1 AND disabled = TRUE`
+	_, err = db.Pool.Exec(db.Context, query, feedID)
+	return err
+}
+
+// GetNewFeedItems returns guids which were not seen before
+func (db *Postgres) GetNewFeedItems(feedID int, guids []string) ([]string, error) {
+	if len(guids) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT g.guid FROM unnest($2::text[]) AS g(guid)
+	WHERE NOT EXISTS (SELECT 1 FROM feed_items fi WHERE fi.feed_id = $1 AND fi.guid = g.guid)`
+
+	rows, err := db.Pool.Query(db.Context, query, feedID, guids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var added []string
+	for rows.Next() {
+		var guid string
+		if err = rows.Scan(&guid); err != nil {
+			return added, err
+		}
+		added = append(added, guid)
+	}
+
+	return added, rows.Err()
+}
+
+// HasFeedItems checks if feed has items history
+func (db *Postgres) HasFeedItems(feedID int) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM feed_items WHERE feed_id = $1)`
+
+	var known bool
+	err := db.Pool.QueryRow(db.Context, query, feedID).Scan(&known)
+	return known, err
+}
+
+// AddFeedItems stores feed items history
+func (db *Postgres) AddFeedItems(feedID int, items []FeedItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	guids := make([]string, len(items))
+	titles := make([]string, len(items))
+	uris := make([]string, len(items))
+	dates := make([]*time.Time, len(items))
+	for i, item := range items {
+		guids[i], titles[i], uris[i], dates[i] = item.GUID, item.Title, item.URI, item.Date
+	}
+
+	query := `INSERT INTO feed_items (feed_id, guid, title, uri, date)
+	SELECT $1, i.guid, i.title, left(i.uri, 1024), i.date
+	FROM unnest($2::text[], $3::text[], $4::text[], $5::timestamptz[]) AS i(guid, title, uri, date)
+	ON CONFLICT (feed_id, guid) DO UPDATE SET seen = CURRENT_TIMESTAMP`
+
+	_, err := db.Pool.Exec(db.Context, query, feedID, guids, titles, uris, dates)
+	return err
+}
+
+// GetFeedItem reads feed item by its short key
+func (db *Postgres) GetFeedItem(feedID int, key string) (*FeedItem, error) {
+	query := `SELECT fi.feed_id, f.name, fi.guid, fi.title, fi.uri, fi.date FROM feed_items fi
+	JOIN feeds f ON f.id = fi.feed_id
+	WHERE fi.feed_id = $1 AND left(md5(fi.guid), $2) = $3
+	LIMIT 1`
+
+	return db.getFeedItem(query, feedID, itemKeyLength, key)
+}
+
+// GetFeedItems returns latest stored feed items, newest first
+func (db *Postgres) GetFeedItems(feedID int, count int) ([]FeedItem, error) {
+	query := `SELECT fi.feed_id, f.name, fi.guid, fi.title, fi.uri, fi.date FROM feed_items fi
+	JOIN feeds f ON f.id = fi.feed_id
+	WHERE fi.feed_id = $1 AND fi.uri <> ''
+	ORDER BY fi.date DESC NULLS LAST, fi.seen DESC
+	LIMIT $2`
+
+	rows, err := db.Pool.Query(db.Context, query, feedID, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []FeedItem
+	for rows.Next() {
+		var item FeedItem
+		if err = rows.Scan(&item.FeedID, &item.Feed, &item.GUID, &item.Title, &item.URI, &item.Date); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// GetUserURIFeedItem reads feed item by its uri among user subscriptions
+func (db *Postgres) GetUserURIFeedItem(userID int64, uri string) (*FeedItem, error) {
+	query := `SELECT fi.feed_id, f.name, fi.guid, fi.title, fi.uri, fi.date FROM feed_items fi
+	JOIN feeds f ON f.id = fi.feed_id
+	JOIN userfeeds uf ON uf.feed_id = fi.feed_id
+	WHERE uf.user_id = $1 AND fi.uri = $2
+	ORDER BY fi.seen DESC
+	LIMIT 1`
+
+	return db.getFeedItem(query, userID, uri)
+}
+
+func (db *Postgres) getFeedItem(query string, args ...interface{}) (*FeedItem, error) {
+	var item FeedItem
+	err := db.Pool.QueryRow(db.Context, query, args...).Scan(&item.FeedID, &item.Feed, &item.GUID, &item.Title, &item.URI, &item.Date)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// ItemKey returns short feed item key which is unique enough within the feed to fit into callback data
+func ItemKey(guid string) string {
+	sum := md5.Sum([]byte(guid))
+	return hex.EncodeToString(sum[:])[:itemKeyLength]
+}
+
+// DeleteFeedItems removes items history which was not seen since specified date
+func (db *Postgres) DeleteFeedItems(before time.Time) error {
+	query := `DELETE FROM feed_items WHERE seen < $1`
+	_, err := db.Pool.Exec(db.Context, query, before)
 	return err
 }
 
-// GetFeedUsers returns active feed subscriptions
+// GetFeedUsers returns active feed subscriptions, paused ones are skipped
 func (db *Postgres) GetFeedUsers(feedID int) ([]UserFeed, error) {
-	query := `SELECT user_id, added FROM userfeeds WHERE feed_id = $1`
+	query := `SELECT uf.user_id, uf.added, COALESCE(u.lang, ''), COALESCE(u.digest, ''), uf.filters,
+	COALESCE(u.timezone, ''), COALESCE(u.quiet_mode, ''), COALESCE(u.quiet_from, 0), COALESCE(u.quiet_to, 0), COALESCE(ch.owner_id, 0) FROM userfeeds uf
+	LEFT JOIN users u ON u.user_id = uf.user_id
+	LEFT JOIN channels ch ON ch.chat_id = uf.user_id
+	WHERE uf.feed_id = $1 AND (uf.paused_until IS NULL OR uf.paused_until <= CURRENT_TIMESTAMP)`
 	rows, err := db.Pool.Query(db.Context, query, &feedID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var subs []UserFeed
 	for rows.Next() {
 		item := UserFeed{FeedID: feedID}
-		err = rows.Scan(&item.UserID, &item.Added)
+		err = rows.Scan(&item.UserID, &item.Added, &item.Lang, &item.Digest, &item.Filters, &item.Timezone, &item.Quiet.Mode, &item.Quiet.From, &item.Quiet.To, &item.ChannelOwner)
 		if err != nil {
 			return subs, err
 		}
@@ -189,22 +447,28 @@ func (db *Postgres) GetFeedUsers(feedID int) ([]UserFeed, error) {
 	return subs, nil
 }
 
-// SetFeedUpdated update feed by new timespan and set healthy to true
+// SetFeedUpdated update feed by new timespan, set healthy to true and reset failures
 func (db *Postgres) SetFeedUpdated(id int) error {
 	query := `UPDATE feeds
 	SET updated = $1,
-	healthy = TRUE
+	healthy = TRUE,
+	failures = 0,
+	last_error = '',
+	disabled = FALSE
 	WHERE id = $2`
 
 	_, err := db.Pool.Exec(db.Context, query, time.Now(), id)
 	return err
 }
 
-// SetFeedLastPub update feed by new timespan, set healthy to true and set last publication date and URI
+// SetFeedLastPub update feed by new timespan, set healthy to true, reset failures and set last publication date and URI
 func (db *Postgres) SetFeedLastPub(id int, lastPub time.Time, lastPubURI string) error {
 	query := `UPDATE feeds
 	SET updated = $1,
 	healthy = TRUE,
+	failures = 0,
+	last_error = '',
+	disabled = FALSE,
 	last_pub = $2,
 	last_pub_uri = $3
 	WHERE id = $4`
@@ -213,40 +477,67 @@ func (db *Postgres) SetFeedLastPub(id int, lastPub time.Time, lastPubURI string)
 	return err
 }
 
-// SetFeedBroken update feed by setting healthy to false
-func (db *Postgres) SetFeedBroken(id int) error {
+// SetFeedSchedule update feed polling interval and next check date
+func (db *Postgres) SetFeedSchedule(id int, interval time.Duration) error {
 	query := `UPDATE feeds
-	SET updated = $1,
-	healthy = FALSE
+	SET check_interval = $1,
+	next_check = CURRENT_TIMESTAMP + make_interval(secs => $1)
 	WHERE id = $2`
 
-	_, err := db.Pool.Exec(db.Context, query, time.Now(), id)
+	_, err := db.Pool.Exec(db.Context, query, int(interval.Seconds()), id)
 	return err
 }
 
-// GetAllUsers returns all unique user IDs who have subscribed to feeds
-func (db *Postgres) GetAllUsers() ([]int64, error) {
-	query := `SELECT DISTINCT user_id FROM userfeeds`
-	rows, err := db.Pool.Query(db.Context, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// SetFeedCache update feed conditional request validators
+func (db *Postgres) SetFeedCache(id int, etag string, lastModified string) error {
+	query := `UPDATE feeds
+	SET etag = $1,
+	last_modified = $2
+	WHERE id = $3`
 
-	var users []int64
-	for rows.Next() {
-		var userID int64
-		err = rows.Scan(&userID)
-		if err != nil {
-			return users, err
-		}
-		users = append(users, userID)
+	_, err := db.Pool.Exec(db.Context, query, etag, lastModified, id)
+	return err
+}
+
+// SetFeedBroken update feed by setting healthy to false, counting failure and postponing next check
+func (db *Postgres) SetFeedBroken(id int, lastError string, retry time.Duration) error {
+	query := `UPDATE feeds
+	SET updated = $1,
+	healthy = FALSE,
+	failures = failures + 1,
+	last_error = $2,
+	next_check = CURRENT_TIMESTAMP + make_interval(secs => $3)
+	WHERE id = $4`
+
+	_, err := db.Pool.Exec(db.Context, query, time.Now(), cropError(lastError), int(retry.Seconds()), id)
+	return err
+}
+
+// DisableFeed update feed by setting healthy to false and excluding it from regular reading, feed is probed again after retry
+func (db *Postgres) DisableFeed(id int, lastError string, retry time.Duration) error {
+	query := `UPDATE feeds
+	SET updated = $1,
+	healthy = FALSE,
+	failures = failures + 1,
+	last_error = $2,
+	disabled = TRUE,
+	next_check = CURRENT_TIMESTAMP + make_interval(secs => $3)
+	WHERE id = $4`
+
+	_, err := db.Pool.Exec(db.Context, query, time.Now(), cropError(lastError), int(retry.Seconds()), id)
+	return err
+}
+
+func cropError(msg string) string {
+	const limit = 1024
+	if len(msg) <= limit {
+		return msg
 	}
 
-	return users, nil
+	return strings.ToValidUTF8(msg[:limit], "")
 }
 
-func toFeed(row pgx.Row) (*Feed, error) {
+func toFeed(row pgx.Row, extra ...interface{}) (*Feed, error) {
 	var id int
 	var name string
 	var normalized string
@@ -255,17 +546,34 @@ func toFeed(row pgx.Row) (*Feed, error) {
 	var healthy bool
 	var lastPub *time.Time
 	var lastPubURI sql.NullString
-
-	if err := row.Scan(&id, &name, &normalized, &uri, &updated, &healthy, &lastPub, &lastPubURI); err == nil {
+	var etag sql.NullString
+	var lastModified sql.NullString
+	var nextCheck *time.Time
+	var checkInterval int
+	var failures int
+	var lastError sql.NullString
+	var disabled bool
+	var link sql.NullString
+
+	dest := []interface{}{&id, &name, &normalized, &uri, &updated, &healthy, &lastPub, &lastPubURI, &etag, &lastModified, &nextCheck, &checkInterval, &failures, &lastError, &disabled, &link}
+	if err := row.Scan(append(dest, extra...)...); err == nil {
 		return &Feed{
-			ID:         id,
-			Name:       name,
-			Normalized: normalized,
-			URI:        uri,
-			Updated:    updated,
-			Healthy:    healthy,
-			LastPub:    lastPub,
-			LastPubURI: lastPubURI.String,
+			ID:            id,
+			Name:          name,
+			Normalized:    normalized,
+			URI:           uri,
+			Updated:       updated,
+			Healthy:       healthy,
+			LastPub:       lastPub,
+			LastPubURI:    lastPubURI.String,
+			ETag:          etag.String,
+			LastModified:  lastModified.String,
+			NextCheck:     nextCheck,
+			CheckInterval: checkInterval,
+			Failures:      failures,
+			LastError:     lastError.String,
+			Disabled:      disabled,
+			Link:          link.String,
 		}, err
 	} else if err == pgx.ErrNoRows {
 		return nil, nil
@@ -277,9 +585,35 @@ func toFeed(row pgx.Row) (*Feed, error) {
 }
 
 func toFeeds(rows pgx.Rows) ([]Feed, error) {
+	return scanFeeds(rows, func(row pgx.Row) (*Feed, error) { return toFeed(row) })
+}
+
+// toUserFeed reads feed columns followed by user subscription columns
+func toUserFeed(row pgx.Row) (*Feed, error) {
+	var filters []string
+	var category string
+	var paused bool
+	var pausedUntil *time.Time
+
+	feed, err := toFeed(row, &filters, &category, &paused, &pausedUntil)
+	if feed != nil {
+		feed.Filters = filters
+		feed.Category = category
+		feed.Paused = paused
+		feed.PausedUntil = pausedUntil
+	}
+
+	return feed, err
+}
+
+func toUserFeeds(rows pgx.Rows) ([]Feed, error) {
+	return scanFeeds(rows, toUserFeed)
+}
+
+func scanFeeds(rows pgx.Rows, scan func(row pgx.Row) (*Feed, error)) ([]Feed, error) {
 	var feeds []Feed
 	for rows.Next() {
-		feed, err := toFeed(rows)
+		feed, err := scan(rows)
 		if err != nil {
 			return feeds, err
 		}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// User represents user settings db table structure
+type User struct {
+	ID         int64
+	Lang       string
+	Digest     string
+	DigestAt   int
+	LastDigest *time.Time
+	Timezone   string
+	Quiet      Quiet
+}
+
+// Quiet represents user quiet hours in minutes of the day by user timezone, empty mode disables them
+type Quiet struct {
+	Mode string
+	From int
+	To   int
+}
+
+// DigestItem represents article waiting for the user digest
+type DigestItem struct {
+	ID     int64
+	UserID int64
+	Feed   string
+	Title  string
+	URI    string
+	Date   *time.Time
+}
+
+// GetUser gets user settings, returns nil when user has default settings
+func (db *Postgres) GetUser(userID int64) (*User, error) {
+	query := `SELECT user_id, lang, digest, digest_at, last_digest, timezone, quiet_mode, quiet_from, quiet_to FROM users WHERE user_id = $1`
+
+	usr := &User{}
+	err := db.Pool.QueryRow(db.Context, query, userID).Scan(&usr.ID, &usr.Lang, &usr.Digest, &usr.DigestAt, &usr.LastDigest, &usr.Timezone, &usr.Quiet.Mode, &usr.Quiet.From, &usr.Quiet.To)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return usr, nil
+}
+
+// SetUserLang updates user preferred language
+func (db *Postgres) SetUserLang(userID int64, lang string) error {
+	query := `INSERT INTO users (user_id, lang) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET lang = $2`
+	_, err := db.Pool.Exec(db.Context, query, userID, lang)
+	return err
+}
+
+// SetUserTimezone updates user timezone name
+func (db *Postgres) SetUserTimezone(userID int64, timezone string) error {
+	query := `INSERT INTO users (user_id, timezone) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET timezone = $2`
+	_, err := db.Pool.Exec(db.Context, query, userID, timezone)
+	return err
+}
+
+// SetUserQuiet updates user quiet hours
+func (db *Postgres) SetUserQuiet(userID int64, quiet Quiet) error {
+	query := `INSERT INTO users (user_id, quiet_mode, quiet_from, quiet_to) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id) DO UPDATE SET quiet_mode = $2, quiet_from = $3, quiet_to = $4`
+	_, err := db.Pool.Exec(db.Context, query, userID, quiet.Mode, quiet.From, quiet.To)
+	return err
+}
+
+// GetAllUsers returns all unique users who have subscribed to feeds, channels are skipped
+func (db *Postgres) GetAllUsers() ([]User, error) {
+	query := `SELECT uf.user_id, COALESCE(u.lang, '') FROM (SELECT DISTINCT user_id FROM userfeeds) uf
+	LEFT JOIN users u ON u.user_id = uf.user_id
+	WHERE NOT EXISTS (SELECT 1 FROM channels ch WHERE ch.chat_id = uf.user_id)`
+
+	rows, err := db.Pool.Query(db.Context, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var usr User
+		if err = rows.Scan(&usr.ID, &usr.Lang); err != nil {
+			return users, err
+		}
+
+		users = append(users, usr)
+	}
+
+	return users, rows.Err()
+}
+
+// SetUserDigest updates user digest mode and minute of the day for daily digest
+func (db *Postgres) SetUserDigest(userID int64, digest string, digestAt int) error {
+	query := `INSERT INTO users (user_id, digest, digest_at, last_digest) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id) DO UPDATE SET digest = $2, digest_at = $3, last_digest = $4`
+	_, err := db.Pool.Exec(db.Context, query, userID, digest, digestAt, time.Now().UTC())
+	return err
+}
+
+// SetUserDigested updates date of the last sent digest
+func (db *Postgres) SetUserDigested(userID int64, at time.Time) error {
+	query := `UPDATE users SET last_digest = $1 WHERE user_id = $2`
+	_, err := db.Pool.Exec(db.Context, query, at.UTC(), userID)
+	return err
+}
+
+// AddDigestItem queues article for the user digest
+func (db *Postgres) AddDigestItem(item DigestItem) error {
+	query := `INSERT INTO digest_items (user_id, feed, title, uri, date) VALUES ($1, $2, $3, $4, $5)`
+	_, err := db.Pool.Exec(db.Context, query, item.UserID, item.Feed, item.Title, item.URI, item.Date)
+	return err
+}
+
+// GetDigestUsers returns settings of the users with queued articles
+func (db *Postgres) GetDigestUsers() ([]User, error) {
+	query := `SELECT di.user_id, COALESCE(u.lang, ''), COALESCE(u.digest, ''), COALESCE(u.digest_at, 0), u.last_digest,
+	COALESCE(u.timezone, ''), COALESCE(u.quiet_mode, ''), COALESCE(u.quiet_from, 0), COALESCE(u.quiet_to, 0)
+	FROM (SELECT DISTINCT user_id FROM digest_items) di
+	LEFT JOIN users u ON u.user_id = di.user_id`
+
+	rows, err := db.Pool.Query(db.Context, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var usr User
+		if err = rows.Scan(&usr.ID, &usr.Lang, &usr.Digest, &usr.DigestAt, &usr.LastDigest, &usr.Timezone, &usr.Quiet.Mode, &usr.Quiet.From, &usr.Quiet.To); err != nil {
+			return users, err
+		}
+
+		users = append(users, usr)
+	}
+
+	return users, rows.Err()
+}
+
+// GetDigestItems returns queued articles of the user ordered by feed
+func (db *Postgres) GetDigestItems(userID int64) ([]DigestItem, error) {
+	query := `SELECT id, user_id, feed, title, uri, date FROM digest_items WHERE user_id = $1 ORDER BY feed, id`
+
+	rows, err := db.Pool.Query(db.Context, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []DigestItem
+	for rows.Next() {
+		var item DigestItem
+		if err = rows.Scan(&item.ID, &item.UserID, &item.Feed, &item.Title, &item.URI, &item.Date); err != nil {
+			return items, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// DeleteDigestItems removes sent articles from the user digest queue
+func (db *Postgres) DeleteDigestItems(userID int64, ids []int64) error {
+	query := `DELETE FROM digest_items WHERE user_id = $1 AND id = ANY($2)`
+	_, err := db.Pool.Exec(db.Context, query, userID, ids)
+	return err
+}
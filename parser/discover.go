@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+)
+
+// Source is a feed found for the web page. Link is filled only when the feed was read, so Title is its real name.
+type Source struct {
+	URL   string
+	Title string
+	Link  string
+}
+
+// feedTypes are link types of the feeds announced by web pages
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// feedPaths are tried when page has no feed links
+var feedPaths = []string{"/feed", "/rss.xml", "/atom.xml"}
+
+const maxPageSize = 2 << 20
+
+// discoverTimeout limits the whole discovery, so a slow site can't hold up the caller with every probed path
+var discoverTimeout = 15 * time.Second
+
+// Discover returns feeds for the uri. Feed uri is returned as is, web pages are searched for
+// alternate links and common feed paths.
+func Discover(uri string) ([]Source, error) {
+	page, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%s': %w", uri, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout)
+	defer cancel()
+
+	body, err := get(ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%s': %w", uri, err)
+	}
+
+	if gofeed.DetectFeedType(bytes.NewReader(body)) != gofeed.FeedTypeUnknown {
+		fp := gofeed.NewParser()
+		fp.RSSTranslator = &rssTranslator{}
+		feed, err := fp.Parse(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read '%s': %w", uri, err)
+		}
+
+		return []Source{{URL: uri, Title: feed.Title, Link: feed.Link}}, nil
+	}
+
+	if sources := findLinks(page, body); len(sources) > 0 {
+		return sources, nil
+	}
+
+	var sources []Source
+	for _, path := range feedPaths {
+		if ctx.Err() != nil {
+			break
+		}
+
+		candidate := page.ResolveReference(&url.URL{Path: path}).String()
+		feed, _, err := fetch(ctx, candidate, Cache{})
+		if err != nil {
+			continue
+		}
+
+		sources = append(sources, Source{URL: candidate, Title: feed.Title, Link: feed.Link})
+	}
+
+	return sources, nil
+}
+
+// findLinks reads <link rel="alternate"> feed entries of the html page
+func findLinks(page *url.URL, body []byte) []Source {
+	var sources []Source
+	seen := make(map[string]bool)
+
+	tokens := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			return sources
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokens.TagName()
+			if string(name) == "body" {
+				return sources
+			}
+
+			if string(name) != "link" || !hasAttr {
+				continue
+			}
+
+			attrs := make(map[string]string)
+			for more := true; more; {
+				var key, val []byte
+				key, val, more = tokens.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+
+			if !hasToken(attrs["rel"], "alternate") || !feedTypes[strings.ToLower(strings.TrimSpace(attrs["type"]))] {
+				continue
+			}
+
+			href, err := page.Parse(strings.TrimSpace(attrs["href"]))
+			if err != nil || len(attrs["href"]) == 0 || seen[href.String()] {
+				continue
+			}
+
+			seen[href.String()] = true
+			sources = append(sources, Source{URL: href.String(), Title: strings.TrimSpace(attrs["title"])})
+		}
+	}
+}
+
+func hasToken(list string, token string) bool {
+	for _, item := range strings.Fields(list) {
+		if strings.EqualFold(item, token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func get(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testPage = `<html><head><title>Blog</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Posts" href="/posts.rss">
+<link rel="alternate" type="application/atom+xml" title="Comments" href="https://example.com/comments.atom">
+<link rel="alternate" type="application/rss+xml" href="/posts.rss">
+</head><body><link rel="alternate" type="application/rss+xml" href="/body.rss"></body></html>`
+
+func TestDiscover_Feed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRss))
+	}))
+	defer srv.Close()
+
+	sources, err := Discover(srv.URL)
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	if len(sources) != 1 || sources[0].URL != srv.URL || sources[0].Title != "Test" {
+		t.Errorf("Expected feed itself, but was %+v", sources)
+	}
+}
+
+func TestDiscover_Links(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testPage))
+	}))
+	defer srv.Close()
+
+	sources, err := Discover(srv.URL + "/blog/")
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	exp := []Source{{URL: srv.URL + "/posts.rss", Title: "Posts"}, {URL: "https://example.com/comments.atom", Title: "Comments"}}
+	if len(sources) != len(exp) {
+		t.Fatalf("Expected %d sources, but was %+v", len(exp), sources)
+	}
+
+	for i := range exp {
+		if sources[i] != exp[i] {
+			t.Errorf("Expected '%+v', but was '%+v'", exp[i], sources[i])
+		}
+	}
+}
+
+func TestDiscover_CommonPaths(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rss.xml":
+			w.Write([]byte(testRss))
+		case "/feed":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Write([]byte("<html><head><title>Blog</title></head><body></body></html>"))
+		}
+	}))
+	defer srv.Close()
+
+	sources, err := Discover(srv.URL + "/blog")
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	if len(sources) != 1 || sources[0].URL != srv.URL+"/rss.xml" || sources[0].Title != "Test" {
+		t.Errorf("Expected feed at common path, but was %+v", sources)
+	}
+}
+
+func TestDiscover_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if _, err := Discover(srv.URL); err == nil {
+		t.Errorf("Expected error for missing page")
+	}
+}
+
+func TestDiscover_Timeout(t *testing.T) {
+	defer func(saved time.Duration) { discoverTimeout = saved }(discoverTimeout)
+	discoverTimeout = 100 * time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte("<html><head><title>Blog</title></head></html>"))
+			return
+		}
+
+		// Probed feed paths hang till the request is cancelled
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	found, err := Discover(srv.URL + "/")
+	if err != nil || len(found) != 0 {
+		t.Errorf("Expected no feeds, but was %v with error %v", found, err)
+	}
+
+	if spent := time.Since(start); spent > time.Second {
+		t.Errorf("Expected discovery to stop on timeout, but it took %s", spent)
+	}
+}
@@ -1,7 +1,13 @@
 package parser
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
 	"time"
 	"unicode/utf8"
 
@@ -11,6 +17,7 @@ import (
 
 // Topic is a lightweight representation of the parsed article
 type Topic struct {
+	GUID  string
 	Feed  string
 	Title string
 	Text  string
@@ -18,44 +25,89 @@ type Topic struct {
 	Date  *time.Time
 }
 
+// Cache holds validators for the conditional feed request
+type Cache struct {
+	ETag         string
+	LastModified string
+
+	// TTL is the minimal polling interval requested by the server headers or feed hints
+	TTL time.Duration
+}
+
+// ErrNotModified is returned when feed server responds with 304 status
+var ErrNotModified = errors.New("feed not modified")
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Info is a feed channel description
+type Info struct {
+	Title       string
+	Link        string
+	Description string
+}
+
 // GetTitle parses uri with RSS/ATOM parser and returns feed name
 func GetTitle(uri string) (string, error) {
-	fp := gofeed.NewParser()
-
-	feed, err := fp.ParseURL(uri)
+	info, err := GetInfo(uri)
 	if err != nil {
-		return "", fmt.Errorf("unable to read '%s': %s", uri, err)
+		return "", err
 	}
 
-	return feed.Title, nil
+	return info.Title, nil
 }
 
-// GetUpdates load artiales since specified date
-func GetUpdates(uri string, since time.Time) ([]Topic, error) {
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(uri)
+// GetInfo parses uri with RSS/ATOM parser and returns feed description
+func GetInfo(uri string) (*Info, error) {
+	feed, _, err := fetch(context.Background(), uri, Cache{})
 	if err != nil {
-		return nil, fmt.Errorf("unable read '%s': %s", uri, err)
+		return nil, fmt.Errorf("unable to read '%s': %w", uri, err)
+	}
+
+	return &Info{Title: feed.Title, Link: feed.Link, Description: feed.Description}, nil
+}
+
+// GetUpdates load artiales since specified date. Articles with no date are always returned.
+// Returns ErrNotModified when server confirms cache validators.
+func GetUpdates(uri string, since time.Time, cache Cache) ([]Topic, Cache, error) {
+	feed, cache, err := fetch(context.Background(), uri, cache)
+	if err == ErrNotModified {
+		return nil, cache, err
+	} else if err != nil {
+		return nil, cache, fmt.Errorf("unable read '%s': %w", uri, err)
 	}
 
 	if feed == nil {
-		return nil, nil
+		return nil, cache, nil
 	}
 
+	return readTopics(feed, since), cache, nil
+}
+
+// GetPreview parses uri with RSS/ATOM parser and returns feed description with all its articles
+func GetPreview(uri string) (*Info, []Topic, error) {
+	feed, _, err := fetch(context.Background(), uri, Cache{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read '%s': %w", uri, err)
+	}
+
+	info := &Info{Title: feed.Title, Link: feed.Link, Description: cropText(html2text.HTML2Text(feed.Description))}
+	return info, readTopics(feed, time.Time{}), nil
+}
+
+func readTopics(feed *gofeed.Feed, since time.Time) []Topic {
 	var topics []Topic
 	for _, item := range feed.Items {
 		date := parseDate(item, feed.Language)
-		if date == nil {
-			continue
-		}
-
-		dateIn := date.In(since.Location())
-		if dateIn.Equal(since) || dateIn.Before(since) {
-			continue
+		if date != nil {
+			dateIn := date.In(since.Location())
+			if dateIn.Equal(since) || dateIn.Before(since) {
+				continue
+			}
 		}
 
 		text := html2text.HTML2Text(item.Description)
 		topic := Topic{
+			GUID:  getGUID(item),
 			Feed:  feed.Title,
 			Title: item.Title,
 			Text:  cropText(text),
@@ -65,27 +117,103 @@ func GetUpdates(uri string, since time.Time) ([]Topic, error) {
 		topics = append(topics, topic)
 	}
 
-	return topics, nil
+	return topics
 }
 
-// GetLast returns topic with latest publish date
+// GetLast returns topic with latest publish date, topics with no date are ignored
 func GetLast(topics []Topic) *Topic {
-	if len(topics) == 0 {
-		return nil
+	var max *Topic
+	for i, topic := range topics {
+		if topic.Date == nil {
+			continue
+		}
+
+		if max != nil && (topic.Date.Equal(*max.Date) || topic.Date.Before(*max.Date)) {
+			continue
+		}
+
+		max = &topics[i]
 	}
 
-	max := topics[0]
-	if len(topics) > 1 {
-		for _, topic := range topics {
-			if topic.Date.Equal(*max.Date) || topic.Date.Before(*max.Date) {
-				continue
-			}
+	return max
+}
 
-			max = topic
+// GetLatest returns up to count topics sorted from the newest one, topics with no date go last
+func GetLatest(topics []Topic, count int) []Topic {
+	latest := make([]Topic, len(topics))
+	copy(latest, topics)
+
+	sort.SliceStable(latest, func(i, j int) bool {
+		if latest[j].Date == nil {
+			return latest[i].Date != nil
 		}
+
+		return latest[i].Date != nil && latest[i].Date.After(*latest[j].Date)
+	})
+
+	if len(latest) > count {
+		latest = latest[:count]
+	}
+
+	return latest
+}
+
+// getGUID returns item unique identifier with fallback to link and content hash
+func getGUID(item *gofeed.Item) string {
+	if len(item.GUID) > 0 {
+		return item.GUID
+	}
+
+	if len(item.Link) > 0 {
+		return item.Link
+	}
+
+	hash := sha1.Sum([]byte(item.Title + item.Description + item.Content))
+	return hex.EncodeToString(hash[:])
+}
+
+func fetch(ctx context.Context, uri string, cache Cache) (*gofeed.Feed, Cache, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, cache, err
+	}
+
+	req.Header.Set("User-Agent", "Gofeed/1.0")
+	if len(cache.ETag) > 0 {
+		req.Header.Set("If-None-Match", cache.ETag)
+	}
+	if len(cache.LastModified) > 0 {
+		req.Header.Set("If-Modified-Since", cache.LastModified)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, cache, err
+	}
+	defer resp.Body.Close()
+
+	cache.TTL = headerTTL(resp.Header)
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cache, ErrNotModified
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, cache, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	fp := gofeed.NewParser()
+	fp.RSSTranslator = &rssTranslator{}
+	feed, err := fp.Parse(resp.Body)
+	if err != nil {
+		return nil, cache, err
+	}
+
+	rst := Cache{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), TTL: cache.TTL}
+	if ttl := feedTTL(feed); ttl > rst.TTL {
+		rst.TTL = ttl
 	}
 
-	return &max
+	return feed, rst, nil
 }
 
 func cropText(txt string) string {
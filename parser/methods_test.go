@@ -1,10 +1,19 @@
 package parser
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/mmcdole/gofeed"
 )
 
+const testRss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>Test</title>
+<item><title>1</title><link>https://example.com/1</link><pubDate>Sat, 04 Jul 2020 15:09:00 +0300</pubDate></item>
+</channel></rss>`
+
 func TestGetLastWithEmpty(t *testing.T) {
 	var topics []Topic
 	result := GetLast(topics)
@@ -46,3 +55,118 @@ func TestGetLastWithMany(t *testing.T) {
 		t.Errorf("Expected to be title '2', but was '%s'", result.Title)
 	}
 }
+
+func TestGetUpdates_ReturnsCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Sat, 04 Jul 2020 15:09:00 GMT")
+		w.Write([]byte(testRss))
+	}))
+	defer srv.Close()
+
+	topics, cache, err := GetUpdates(srv.URL, time.Time{}, Cache{})
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	if len(topics) != 1 {
+		t.Errorf("Expected 1 topic, but was %d", len(topics))
+	}
+
+	if cache.ETag != `"v1"` || cache.LastModified != "Sat, 04 Jul 2020 15:09:00 GMT" {
+		t.Errorf("Unexpected cache validators '%s' and '%s'", cache.ETag, cache.LastModified)
+	}
+}
+
+func TestGetUpdates_NotModified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write([]byte(testRss))
+	}))
+	defer srv.Close()
+
+	cache := Cache{ETag: `"v1"`}
+	topics, rst, err := GetUpdates(srv.URL, time.Time{}, cache)
+	if err != ErrNotModified {
+		t.Errorf("Expected ErrNotModified, but was: %v", err)
+	}
+
+	if len(topics) != 0 {
+		t.Errorf("Expected no topics, but was %d", len(topics))
+	}
+
+	if rst != cache {
+		t.Errorf("Expected cache to be kept, but was '%v'", rst)
+	}
+}
+
+func TestGetLastWithNoDate(t *testing.T) {
+	now := time.Now()
+	topics := []Topic{
+		{Title: "1"},
+		{Title: "2", Date: &now},
+	}
+	result := GetLast(topics)
+	if result == nil || result.Title != "2" {
+		t.Errorf("Expected to be title '2', but was '%v'", result)
+	}
+
+	if GetLast([]Topic{{Title: "1"}}) != nil {
+		t.Errorf("Expected to be empty for topics with no date")
+	}
+}
+
+func TestGetGUID_Fallbacks(t *testing.T) {
+	if rst := getGUID(&gofeed.Item{GUID: "guid", Link: "link"}); rst != "guid" {
+		t.Errorf("Expected 'guid', but was '%s'", rst)
+	}
+
+	if rst := getGUID(&gofeed.Item{Link: "link"}); rst != "link" {
+		t.Errorf("Expected 'link', but was '%s'", rst)
+	}
+
+	first := getGUID(&gofeed.Item{Title: "title", Description: "text"})
+	second := getGUID(&gofeed.Item{Title: "title", Description: "text"})
+	if len(first) == 0 || first != second {
+		t.Errorf("Expected stable content hash, but was '%s' and '%s'", first, second)
+	}
+}
+
+func TestGetLatest(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-1 * time.Hour)
+
+	topics := []Topic{{Title: "1"}, {Title: "2", Date: &before}, {Title: "3", Date: &now}, {Title: "4"}}
+	result := GetLatest(topics, 3)
+
+	exp := []string{"3", "2", "1"}
+	if len(result) != len(exp) {
+		t.Fatalf("Expected %d topics, but was %d", len(exp), len(result))
+	}
+
+	for i, title := range exp {
+		if result[i].Title != title {
+			t.Errorf("Expected title '%s' at %d, but was '%s'", title, i, result[i].Title)
+		}
+	}
+}
+
+func TestGetPreview(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRss))
+	}))
+	defer srv.Close()
+
+	info, topics, err := GetPreview(srv.URL)
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	if info.Title != "Test" || len(topics) != 1 {
+		t.Errorf("Expected 'Test' feed with 1 topic, but was '%s' with %d", info.Title, len(topics))
+	}
+}
@@ -4,29 +4,43 @@ import (
 	"encoding/xml"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type opml struct {
 	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr,omitempty"`
+	Head    *head    `xml:"head,omitempty"`
 	Body    body     `xml:"body"`
 }
 
+type head struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
 type body struct {
 	XMLName  xml.Name  `xml:"body"`
 	Outlines []outline `xml:"outline"`
 }
 
 type outline struct {
-	XMLName xml.Name `xml:"outline"`
-	Type    string   `xml:"type,attr"`
-	Text    string   `xml:"text,attr"`
-	URL     string   `xml:"xmlUrl,attr"`
+	XMLName  xml.Name  `xml:"outline"`
+	Type     string    `xml:"type,attr,omitempty"`
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	URL      string    `xml:"xmlUrl,attr,omitempty"`
+	Link     string    `xml:"htmlUrl,attr,omitempty"`
+	Outlines []outline `xml:"outline"`
 }
 
 // OpmlItem is an single feed from opml file
 type OpmlItem struct {
-	Title string
-	URL   string
+	Title    string
+	URL      string
+	Link     string
+	Category string
 }
 
 // ReadOmpl read stream for opml file structure and parse feeds from file
@@ -51,12 +65,62 @@ func decode(io io.Reader) ([]OpmlItem, error) {
 		return []OpmlItem{}, nil
 	}
 
+	return walk(fl.Body.Outlines, ""), nil
+}
+
+// walk reads feeds from nested outlines, folder name is kept as a category of its feeds
+func walk(outlines []outline, category string) []OpmlItem {
 	var result []OpmlItem
-	for _, outline := range fl.Body.Outlines {
-		if outline.Type == "rss" {
-			result = append(result, OpmlItem{Title: outline.Text, URL: outline.URL})
+	for _, item := range outlines {
+		title := strings.TrimSpace(item.Text)
+		if len(title) == 0 {
+			title = strings.TrimSpace(item.Title)
 		}
+
+		if len(strings.TrimSpace(item.URL)) > 0 {
+			result = append(result, OpmlItem{Title: title, URL: strings.TrimSpace(item.URL), Link: item.Link, Category: category})
+		}
+
+		if len(item.Outlines) > 0 {
+			folder := title
+			if len(folder) == 0 {
+				folder = category
+			}
+			result = append(result, walk(item.Outlines, folder)...)
+		}
+	}
+
+	return result
+}
+
+// WriteOpml builds OPML 2.0 document with specified feeds
+func WriteOpml(title string, items []OpmlItem) ([]byte, error) {
+	fl := opml{
+		Version: "2.0",
+		Head:    &head{Title: title, DateCreated: time.Now().UTC().Format(time.RFC1123Z)},
+	}
+
+	folders := make(map[string]int)
+	for _, item := range items {
+		feed := outline{Type: "rss", Text: item.Title, Title: item.Title, URL: item.URL, Link: item.Link}
+		if len(item.Category) == 0 {
+			fl.Body.Outlines = append(fl.Body.Outlines, feed)
+			continue
+		}
+
+		idx, ok := folders[item.Category]
+		if !ok {
+			idx = len(fl.Body.Outlines)
+			folders[item.Category] = idx
+			fl.Body.Outlines = append(fl.Body.Outlines, outline{Text: item.Category, Title: item.Category})
+		}
+		fl.Body.Outlines[idx].Outlines = append(fl.Body.Outlines[idx].Outlines, feed)
+	}
+
+	data, err := xml.MarshalIndent(fl, "", "  ")
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	return append([]byte(xml.Header), data...), nil
 }
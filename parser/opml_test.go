@@ -32,3 +32,88 @@ func TestDecode(t *testing.T) {
 		t.Errorf("Expected 'feed2-feed2XMLUri', but was '%s-%s'", rst[1].Title, rst[1].URL)
 	}
 }
+
+func TestWriteOpml(t *testing.T) {
+	items := []OpmlItem{
+		{Title: "feed1", URL: "feed1XMLUri", Link: "feed1HTMLUri"},
+		{Title: "feed2 & more", URL: "feed2XMLUri"},
+	}
+
+	data, err := WriteOpml("Test Opml file", items)
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	rst, err := decode(strings.NewReader(string(data)))
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	if len(rst) != 2 {
+		t.Fatalf("Expected array of length 2, but was %d", len(rst))
+	}
+
+	for i := range items {
+		if rst[i] != items[i] {
+			t.Errorf("Expected '%v', but was '%v'", items[i], rst[i])
+		}
+	}
+}
+
+func TestDecode_NestedOutlines(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+	<opml version="2.0">
+	<body>
+		<outline text="News" title="News">
+			<outline type="atom" text="feed1" xmlUrl="feed1XMLUri"/>
+			<outline text="Local">
+				<outline title="feed2" xmlUrl="feed2XMLUri"/>
+			</outline>
+		</outline>
+		<outline text="feed3" xmlUrl="feed3XMLUri"/>
+		<outline text="Empty"/>
+	</body></opml>`
+
+	rst, err := decode(strings.NewReader(xml))
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	exp := []OpmlItem{
+		{Title: "feed1", URL: "feed1XMLUri", Category: "News"},
+		{Title: "feed2", URL: "feed2XMLUri", Category: "Local"},
+		{Title: "feed3", URL: "feed3XMLUri"},
+	}
+
+	if len(rst) != len(exp) {
+		t.Fatalf("Expected array of length %d, but was %d", len(exp), len(rst))
+	}
+
+	for i := range exp {
+		if rst[i] != exp[i] {
+			t.Errorf("Expected '%v', but was '%v'", exp[i], rst[i])
+		}
+	}
+}
+
+func TestWriteOpml_Categories(t *testing.T) {
+	items := []OpmlItem{
+		{Title: "feed1", URL: "feed1XMLUri", Category: "News"},
+		{Title: "feed2", URL: "feed2XMLUri"},
+		{Title: "feed3", URL: "feed3XMLUri", Category: "News"},
+	}
+
+	data, err := WriteOpml("Test Opml file", items)
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	rst, err := decode(strings.NewReader(string(data)))
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	if len(rst) != 3 || rst[0].Category != "News" || rst[1].Category != "News" || rst[2].Category != "" {
+		t.Errorf("Expected feeds grouped by category, but was '%v'", rst)
+	}
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+const frequencyItems = 10
+
+var syPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// GetFrequency returns average posting interval of the latest dated topics till now.
+// Counting time since the latest topic makes stale feeds to look less frequent.
+func GetFrequency(topics []Topic) time.Duration {
+	var dates []time.Time
+	for _, topic := range topics {
+		if topic.Date != nil {
+			dates = append(dates, *topic.Date)
+		}
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].After(dates[j]) })
+	if len(dates) > frequencyItems {
+		dates = dates[:frequencyItems]
+	}
+
+	if len(dates) == 0 {
+		return 0
+	}
+
+	return time.Since(dates[len(dates)-1]) / time.Duration(len(dates))
+}
+
+// rssTranslator keeps channel ttl which is dropped by the default translator
+type rssTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+func (t *rssTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	rst, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return rst, err
+	}
+
+	if src, ok := feed.(*rss.Feed); ok && len(src.TTL) > 0 {
+		if rst.Custom == nil {
+			rst.Custom = make(map[string]string)
+		}
+		rst.Custom["ttl"] = src.TTL
+	}
+
+	return rst, nil
+}
+
+// feedTTL reads update hints from rss ttl and syndication module
+func feedTTL(feed *gofeed.Feed) time.Duration {
+	var ttl time.Duration
+	if mins, err := strconv.Atoi(strings.TrimSpace(feed.Custom["ttl"])); err == nil && mins > 0 {
+		ttl = time.Duration(mins) * time.Minute
+	}
+
+	sy, ok := feed.Extensions["sy"]
+	if !ok {
+		return ttl
+	}
+
+	var period time.Duration
+	if ext := sy["updatePeriod"]; len(ext) > 0 {
+		period = syPeriods[strings.ToLower(strings.TrimSpace(ext[0].Value))]
+	}
+
+	if ext := sy["updateFrequency"]; len(ext) > 0 && period > 0 {
+		if freq, err := strconv.Atoi(strings.TrimSpace(ext[0].Value)); err == nil && freq > 0 {
+			period = period / time.Duration(freq)
+		}
+	}
+
+	if period > ttl {
+		ttl = period
+	}
+
+	return ttl
+}
+
+// headerTTL reads update hints from Cache-Control and Retry-After headers
+func headerTTL(header http.Header) time.Duration {
+	var ttl time.Duration
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(directive), "=")
+		if !found || strings.ToLower(name) != "max-age" {
+			continue
+		}
+
+		if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && secs > 0 {
+			ttl = time.Duration(secs) * time.Second
+		}
+	}
+
+	if retry := strings.TrimSpace(header.Get("Retry-After")); len(retry) > 0 {
+		var after time.Duration
+		if secs, err := strconv.Atoi(retry); err == nil {
+			after = time.Duration(secs) * time.Second
+		} else if date, err := http.ParseTime(retry); err == nil {
+			after = time.Until(date)
+		}
+
+		if after > ttl {
+			ttl = after
+		}
+	}
+
+	return ttl
+}
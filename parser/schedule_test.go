@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestGetFrequency_NoDates(t *testing.T) {
+	if rst := GetFrequency([]Topic{{}, {}}); rst != 0 {
+		t.Errorf("Expected zero frequency, but was %s", rst)
+	}
+}
+
+func TestGetFrequency_Average(t *testing.T) {
+	now := time.Now()
+	first := now.Add(-3 * time.Hour)
+	second := now.Add(-6 * time.Hour)
+
+	rst := GetFrequency([]Topic{{Date: &second}, {Date: &now}, {Date: &first}, {}})
+	if rst < 2*time.Hour || rst > 2*time.Hour+time.Minute {
+		t.Errorf("Expected 2h frequency, but was %s", rst)
+	}
+}
+
+func TestGetFrequency_Stale(t *testing.T) {
+	first := time.Now().Add(-10 * time.Hour)
+	second := first.Add(-2 * time.Hour)
+
+	rst := GetFrequency([]Topic{{Date: &first}, {Date: &second}})
+	if rst < 6*time.Hour {
+		t.Errorf("Expected at least 6h frequency, but was %s", rst)
+	}
+}
+
+func TestHeaderTTL(t *testing.T) {
+	header := http.Header{}
+	header.Set("Cache-Control", "public, max-age=300")
+	if rst := headerTTL(header); rst != 5*time.Minute {
+		t.Errorf("Expected 5m, but was %s", rst)
+	}
+
+	header.Set("Retry-After", "3600")
+	if rst := headerTTL(header); rst != time.Hour {
+		t.Errorf("Expected 1h, but was %s", rst)
+	}
+}
+
+func TestFeedTTL(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="UTF-8"?>
+	<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+	<channel><title>Test</title><ttl>60</ttl>
+	<sy:updatePeriod>daily</sy:updatePeriod><sy:updateFrequency>4</sy:updateFrequency>
+	</channel></rss>`
+
+	fp := gofeed.NewParser()
+	fp.RSSTranslator = &rssTranslator{}
+	feed, err := fp.Parse(strings.NewReader(xml))
+	if err != nil {
+		t.Errorf("Error not expected, but was: %s", err)
+	}
+
+	if rst := feedTTL(feed); rst != 6*time.Hour {
+		t.Errorf("Expected 6h, but was %s", rst)
+	}
+}
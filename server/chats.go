@@ -0,0 +1,58 @@
+package server
+
+import (
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// groupAdminVerbs are commands which change chat settings, only chat administrators can call them in groups
+var groupAdminVerbs = map[string]bool{
+	"add": true, "import": true, "remove": true, "unsubscribe": true, "filter": true, "digest": true,
+	"pause": true, "resume": true, "mute": true, "lang": true, "timezone": true, "quiet": true,
+	"save": true, "unsave": true,
+}
+
+// channelVerbs are commands which can be called for the linked channel from the owner private chat
+var channelVerbs = map[string]bool{
+	"add": true, "remove": true, "list": true, "last": true, "filter": true, "digest": true,
+	"pause": true, "resume": true, "lang": true, "timezone": true, "quiet": true,
+}
+
+// Telegram chat requests, replaced in tests
+var (
+	getChatMember = func(chatID int64, userID int) (tgbotapi.ChatMember, error) {
+		return bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID})
+	}
+
+	getBotMember = func(chatID int64) (tgbotapi.ChatMember, error) {
+		return bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: bot.Self.ID})
+	}
+
+	getChannel = func(name string) (tgbotapi.Chat, error) {
+		return bot.GetChat(tgbotapi.ChatConfig{SuperGroupUsername: name})
+	}
+)
+
+// chatAdmin checks if user is creator or administrator of the chat
+func chatAdmin(chatID int64, userID int) bool {
+	member, err := getChatMember(chatID, userID)
+	if err != nil {
+		log.Printf("WARN Unable to check user %d rights in chat %d: %s", userID, chatID, err)
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// forBot checks if command is addressed to this bot, commands in groups may be called as /command@bot
+func forBot(command string) bool {
+	_, name, ok := strings.Cut(command, "@")
+	return !ok || bot == nil || strings.EqualFold(name, bot.Self.UserName)
+}
+
+// channelName returns channel public name with leading @
+func channelName(name string) string {
+	return "@" + strings.TrimPrefix(strings.TrimSpace(name), "@")
+}
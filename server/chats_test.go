@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestForBot(t *testing.T) {
+	defer func(saved *tgbotapi.BotAPI) { bot = saved }(bot)
+	bot = &tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "AddRssBot"}}
+
+	cases := map[string]bool{
+		"add":           true,
+		"add@addrssbot": true,
+		"add@AddRssBot": true,
+		"add@OtherBot":  false,
+		"":              true,
+	}
+
+	for in, exp := range cases {
+		if rst := forBot(in); rst != exp {
+			t.Errorf("Expected '%v' for '%s', but was '%v'", exp, in, rst)
+		}
+	}
+}
+
+func TestChatAdmin(t *testing.T) {
+	defer func(saved func(int64, int) (tgbotapi.ChatMember, error)) { getChatMember = saved }(getChatMember)
+
+	for status, exp := range map[string]bool{"creator": true, "administrator": true, "member": false, "left": false} {
+		getChatMember = func(int64, int) (tgbotapi.ChatMember, error) { return tgbotapi.ChatMember{Status: status}, nil }
+		if rst := chatAdmin(1, 2); rst != exp {
+			t.Errorf("Expected '%v' for '%s', but was '%v'", exp, status, rst)
+		}
+	}
+}
+
+func TestChannelName(t *testing.T) {
+	for _, in := range []string{"news", "@news", " @news "} {
+		if rst := channelName(in); rst != "@news" {
+			t.Errorf("Expected '@news' for '%s', but was '%s'", in, rst)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package server
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/go-pkgz/lgr"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -14,49 +16,118 @@ import (
 // Command is to aggregate message information and execute user command
 type Command struct {
 	userID     int64
+	fromID     int
+	group      bool
 	admin      bool
 	adminID    int64
 	verb       string
 	args       string
 	fileId     string
 	lang       string
+	timezone   string
 	raw        *tgbotapi.Message
+	replyTo    *tgbotapi.Message
+	callback   bool
+	forChannel string
+	markup     *tgbotapi.InlineKeyboardMarkup
 	replyQueue chan Reply
 }
 
 var emptyText string
 
+const (
+	defaultDigestAt = 9 * 60
+	muteDuration    = 24 * time.Hour
+	savedPageSize   = 10
+	saveReply       = "save"
+	allFeeds        = "all"
+	previewItems    = 3
+	lastItems       = 5
+	maxLastItems    = 20
+)
+
+// newCommand builds command from user message, returns nil for messages the bot should ignore
 func newCommand(msg *tgbotapi.Message, opt *Options, replyQueue chan Reply) *Command {
+	if !forBot(msg.CommandWithAt()) {
+		return nil
+	}
+
 	cmd := &Command{
 		userID:     msg.Chat.ID,
+		fromID:     msg.From.ID,
+		group:      msg.Chat.IsGroup() || msg.Chat.IsSuperGroup(),
 		admin:      msg.Chat.ID == opt.BotAdmin,
 		adminID:    opt.BotAdmin,
-		verb:       msg.CommandWithAt(),
+		verb:       msg.Command(),
 		args:       msg.CommandArguments(),
 		lang:       msg.From.LanguageCode,
 		raw:        msg,
 		replyQueue: replyQueue,
 	}
 
-	if msg.Document != nil {
+	// Files in groups are imported only with /import caption, other documents are members conversation
+	if msg.Document != nil && (!cmd.group || strings.HasPrefix(msg.Caption, "/import")) {
 		cmd.fileId = msg.Document.FileID
 	}
 
+	// Replying "save" to the delivered article is the same as pressing its save button
+	if msg.ReplyToMessage != nil && strings.EqualFold(strings.TrimSpace(msg.Text), saveReply) {
+		cmd.verb = saveReply
+		cmd.replyTo = msg.ReplyToMessage
+	}
+
+	if cmd.group && len(cmd.verb) == 0 && len(cmd.fileId) == 0 {
+		return nil
+	}
+
 	return cmd
 }
 
+// newCallbackCommand builds command from signed inline button data in "verb args sign" format, returns nil for forged data
+func newCallbackCommand(query *tgbotapi.CallbackQuery, opt *Options, replyQueue chan Reply) *Command {
+	data, ok := verifyCallback(query.Message.Chat.ID, query.Data)
+	if !ok {
+		log.Printf("WARN User %d sent callback with wrong signature '%s'", query.Message.Chat.ID, query.Data)
+		return nil
+	}
+
+	verb, args, _ := strings.Cut(data, " ")
+	return &Command{
+		userID:     query.Message.Chat.ID,
+		fromID:     query.From.ID,
+		group:      query.Message.Chat.IsGroup() || query.Message.Chat.IsSuperGroup(),
+		admin:      query.Message.Chat.ID == opt.BotAdmin,
+		adminID:    opt.BotAdmin,
+		verb:       verb,
+		args:       args,
+		lang:       query.From.LanguageCode,
+		raw:        &tgbotapi.Message{Text: data, Chat: query.Message.Chat, From: query.From},
+		callback:   true,
+		replyQueue: replyQueue,
+	}
+}
+
 func (cmd *Command) run() []Reply {
 	log.Printf("DEBUG request: %s", cmd.raw.Text)
+	cmd.lang, cmd.timezone = userSettings(cmd.userID, cmd.lang)
+
+	if cmd.group && (len(cmd.fileId) != 0 || groupAdminVerbs[cmd.verb]) && !chatAdmin(cmd.userID, cmd.fromID) {
+		log.Printf("WARN User %d is not an admin of group %d to call '%s'", cmd.fromID, cmd.userID, cmd.verb)
+		response, _ := templates.ToText(cmd.lang, "group-admin-only")
+		return []Reply{{ChatID: cmd.userID, Text: response}}
+	}
 
 	var replies []Reply
 	var response string
 	var err error
 
 	if len(cmd.fileId) != 0 {
+		commandsRun.WithLabelValues("import").Inc()
 		response, err = cmd.importOpml()
 	}
 
 	if len(cmd.verb) > 0 {
+		verb := cmd.verb
 		switch cmd.verb {
 		case "stats":
 			response, err = cmd.stats()
@@ -66,18 +137,54 @@ func (cmd *Command) run() []Reply {
 			response, err = cmd.start()
 		case "help":
 			response, err = cmd.help()
+		case "lang":
+			response, err = cmd.setLang()
+		case "timezone":
+			response, err = cmd.setTimezone()
+		case "quiet":
+			response, err = cmd.quiet()
 		case "add":
 			response, err = cmd.add()
+		case "preview":
+			response, err = cmd.preview()
 		case "import":
 			response, err = cmd.importOpml() // simply call for validation message
 		case "remove":
 			response, err = cmd.remove()
+		case "unsubscribe":
+			response, err = cmd.unsubscribe()
+		case "pause":
+			response, err = cmd.pause()
+		case "resume":
+			response, err = cmd.resume()
+		case "mute":
+			response, err = cmd.mute()
+		case "save":
+			response, err = cmd.save()
+		case "saved":
+			response, err = cmd.saved()
+		case "unsave":
+			response, err = cmd.unsave()
 		case "list":
 			response, err = cmd.list()
+		case "last":
+			response, err = cmd.last()
+		case "export":
+			response, err = cmd.exportOpml()
+		case "digest":
+			response, err = cmd.digest()
+		case "filter":
+			response, err = cmd.filter()
+		case "channel":
+			response, err = cmd.channel()
 		case "feedback":
 			replies = cmd.feedbackMulti()
+		default:
+			verb = "unknown"
 		}
 
+		commandsRun.WithLabelValues(verb).Inc()
+
 		log.Printf("INFO User %d call '%s'", cmd.userID, cmd.verb)
 	}
 
@@ -95,7 +202,7 @@ func (cmd *Command) run() []Reply {
 		response, _ = templates.ToText(cmd.lang, "cmd-unknown")
 	}
 
-	return []Reply{{ChatID: cmd.userID, Text: response}}
+	return []Reply{{ChatID: cmd.userID, Text: response, Markup: cmd.markup}}
 }
 
 func (cmd *Command) stats() (string, error) {
@@ -112,25 +219,109 @@ func (cmd *Command) stats() (string, error) {
 }
 
 func (cmd *Command) start() (string, error) {
+	usr, err := db.GetUser(cmd.userID)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if usr == nil || len(usr.Lang) == 0 {
+		lang := strings.ToLower(cmd.lang)
+		if !templates.Supported(lang) {
+			lang = templates.DefaultLang
+		}
+
+		if err = db.SetUserLang(cmd.userID, lang); err != nil {
+			return emptyText, err
+		}
+	}
+
 	return templates.ToText(cmd.lang, "start-success")
 }
 
+func (cmd *Command) setLang() (string, error) {
+	lang := strings.ToLower(strings.TrimSpace(cmd.args))
+	if !templates.Supported(lang) {
+		return templates.ToTextW(cmd.lang, "lang-validation", struct {
+			Current   string
+			Languages []string
+		}{strings.ToLower(cmd.lang), templates.Languages()})
+	}
+
+	if err := db.SetUserLang(cmd.userID, lang); err != nil {
+		return emptyText, err
+	}
+
+	cmd.lang = lang
+	return templates.ToText(cmd.lang, "lang-success")
+}
+
 func (cmd *Command) help() (string, error) {
 	return templates.ToText(cmd.lang, "help-success")
 }
 
 func (cmd *Command) add() (string, error) {
-	if len(cmd.args) == 0 {
+	uri := cmd.args
+	if cmd.callback {
+		var ok bool
+		if uri, ok = sources.get(cmd.args); !ok {
+			return templates.ToText(cmd.lang, "add-expired")
+		}
+	}
+
+	if len(uri) == 0 {
 		return templates.ToText(cmd.lang, "add-validation")
 	}
 
-	if userFeed, err := db.GetUserURIFeed(cmd.userID, cmd.args); err != nil {
+	if userFeed, err := db.GetUserURIFeed(cmd.userID, uri); err != nil {
 		return emptyText, err
 	} else if userFeed != nil {
 		return templates.ToTextW(cmd.lang, "add-exists", userFeed)
 	}
 
-	feed, err := addFeed(cmd.userID, cmd.args, "")
+	src := parser.Source{URL: uri}
+	if known, err := db.GetFeed(uri); err != nil {
+		return emptyText, err
+	} else if known == nil {
+		found, err := parser.Discover(uri)
+		if err != nil {
+			return emptyText, err
+		}
+
+		switch len(found) {
+		case 0:
+			return templates.ToTextW(cmd.lang, "add-not-found", uri)
+		case 1:
+			src = found[0]
+		default:
+			// Buttons are signed for the chat they are sent to and can't pick a feed for the channel
+			if len(cmd.forChannel) > 0 {
+				return templates.ToTextW(cmd.lang, "channel-add-choice", struct {
+					Channel string
+					Sources []parser.Source
+				}{cmd.forChannel, found})
+			}
+
+			markup := sourcesMarkup(cmd.userID, found)
+			cmd.markup = &markup
+			return templates.ToTextW(cmd.lang, "add-choice", found)
+		}
+	}
+
+	// Page address differs from the discovered feed one
+	if src.URL != uri {
+		if userFeed, err := db.GetUserURIFeed(cmd.userID, src.URL); err != nil {
+			return emptyText, err
+		} else if userFeed != nil {
+			return templates.ToTextW(cmd.lang, "add-exists", userFeed)
+		}
+	}
+
+	item := parser.OpmlItem{URL: src.URL}
+	if len(src.Link) > 0 {
+		item.Title, item.Link = src.Title, src.Link
+	}
+
+	feed, err := addFeed(cmd.userID, item)
 	if err != nil {
 		return emptyText, err
 	}
@@ -138,6 +329,48 @@ func (cmd *Command) add() (string, error) {
 	return templates.ToTextW(cmd.lang, "add-success", feed)
 }
 
+// preview shows feed description and latest articles, feed is added only when user presses the subscribe button
+func (cmd *Command) preview() (string, error) {
+	if len(cmd.args) == 0 {
+		return templates.ToText(cmd.lang, "preview-validation")
+	}
+
+	info, topics, err := parser.GetPreview(cmd.args)
+	if err != nil {
+		return emptyText, err
+	}
+
+	var items []string
+	for _, topic := range parser.GetLatest(topics, previewItems) {
+		txt, err := templates.ToTextW(cmd.lang, "topic", topic)
+		if err != nil {
+			return emptyText, err
+		}
+		items = append(items, txt)
+	}
+
+	// Round posting interval to hours or days for the message
+	var hours, days int
+	if freq := parser.GetFrequency(topics); freq >= 24*time.Hour {
+		days = int((freq + 12*time.Hour) / (24 * time.Hour))
+	} else if freq > 0 {
+		hours = max(int((freq+30*time.Minute)/time.Hour), 1)
+	}
+
+	subscribe, _ := templates.ToText(cmd.lang, "button-subscribe")
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(newButton(cmd.userID, subscribe, "add", sources.put(cmd.args))),
+	)
+	cmd.markup = &markup
+
+	return templates.ToTextW(cmd.lang, "preview-success", struct {
+		*parser.Info
+		Hours int
+		Days  int
+		Items []string
+	}{info, hours, days, items})
+}
+
 func (cmd *Command) importOpml() (string, error) {
 	if len(cmd.fileId) == 0 {
 		return templates.ToText(cmd.lang, "import-validation")
@@ -153,22 +386,65 @@ func (cmd *Command) importOpml() (string, error) {
 		return emptyText, fmt.Errorf("error while parsing OMPL file, %s", err)
 	}
 
-	result := struct {
-		Added  int
-		Errors int
-	}{}
+	return templates.ToTextW(cmd.lang, "import-success", importFeeds(cmd.userID, items))
+}
+
+// Reasons for the skipped import entries
+const (
+	skipInvalid   = "invalid"
+	skipDuplicate = "duplicate"
+	skipError     = "error"
+)
+
+const maxSkippedReport = 20
 
+type importSkip struct {
+	Title  string
+	URL    string
+	Reason string
+}
+
+type importResult struct {
+	Added   int
+	Errors  int
+	Skipped []importSkip
+	More    int
+}
+
+func importFeeds(userID int64, items []parser.OpmlItem) importResult {
+	var result importResult
+	skip := func(item parser.OpmlItem, reason string) {
+		result.Errors++
+		if len(result.Skipped) < maxSkippedReport {
+			result.Skipped = append(result.Skipped, importSkip{Title: item.Title, URL: item.URL, Reason: reason})
+		} else {
+			result.More++
+		}
+	}
+
+	seen := make(map[string]bool)
 	for _, item := range items {
-		_, err = addFeed(cmd.userID, item.URL, item.Title)
-		if err != nil {
+		if !validURI(item.URL) {
+			skip(item, skipInvalid)
+			continue
+		}
+
+		if seen[item.URL] {
+			skip(item, skipDuplicate)
+			continue
+		}
+		seen[item.URL] = true
+
+		if _, err := addFeed(userID, item); err != nil {
 			log.Printf("ERROR Feed '%s' was not imported with error: '%s'", item.URL, err)
-			result.Errors++
-		} else {
-			result.Added++
+			skip(item, skipError)
+			continue
 		}
+
+		result.Added++
 	}
 
-	return templates.ToTextW(cmd.lang, "import-success", result)
+	return result
 }
 
 func (cmd *Command) remove() (string, error) {
@@ -181,11 +457,30 @@ func (cmd *Command) remove() (string, error) {
 		return emptyText, err
 	}
 
+	return cmd.unsubscribeFeed(feed)
+}
+
+// unsubscribe removes subscription by feed id, used by inline buttons
+func (cmd *Command) unsubscribe() (string, error) {
+	feedID, err := strconv.Atoi(cmd.args)
+	if err != nil {
+		return templates.ToText(cmd.lang, "remove-no-rows")
+	}
+
+	feed, err := db.GetUserIDFeed(cmd.userID, feedID)
+	if err != nil {
+		return emptyText, err
+	}
+
+	return cmd.unsubscribeFeed(feed)
+}
+
+func (cmd *Command) unsubscribeFeed(feed *database.Feed) (string, error) {
 	if feed == nil {
 		return templates.ToText(cmd.lang, "remove-no-rows")
 	}
 
-	err = db.Unsubscribe(cmd.userID, feed.ID)
+	err := db.Unsubscribe(cmd.userID, feed.ID)
 	if err != nil {
 		return emptyText, err
 	}
@@ -193,6 +488,250 @@ func (cmd *Command) remove() (string, error) {
 	return templates.ToTextW(cmd.lang, "remove-success", feed)
 }
 
+// pause stops feed updates for a period or until resume, "all" pauses every subscription
+func (cmd *Command) pause() (string, error) {
+	args := splitNonEmpty(strings.TrimSpace(cmd.args))
+	if len(args) == 0 || len(args) > 2 {
+		return templates.ToText(cmd.lang, "pause-validation")
+	}
+
+	var until *time.Time
+	if len(args) == 2 {
+		period, ok := parsePeriod(args[1])
+		if !ok {
+			return templates.ToText(cmd.lang, "pause-validation")
+		}
+
+		at := time.Now().In(cmd.location()).Add(period)
+		until = &at
+	}
+
+	feed, err := cmd.pauseTarget(args[0])
+	if err != nil {
+		return emptyText, err
+	}
+
+	if feed == nil {
+		return templates.ToText(cmd.lang, "remove-no-rows")
+	}
+
+	if err = db.Pause(cmd.userID, feed.ID, until); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "pause-success", struct {
+		Feed  *database.Feed
+		Until *time.Time
+	}{feed, until})
+}
+
+// resume restores paused feed updates, "all" resumes every subscription
+func (cmd *Command) resume() (string, error) {
+	args := splitNonEmpty(strings.TrimSpace(cmd.args))
+	if len(args) != 1 {
+		return templates.ToText(cmd.lang, "resume-validation")
+	}
+
+	feed, err := cmd.pauseTarget(args[0])
+	if err != nil {
+		return emptyText, err
+	}
+
+	if feed == nil {
+		return templates.ToText(cmd.lang, "remove-no-rows")
+	}
+
+	if err = db.Resume(cmd.userID, feed.ID); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "resume-success", feed)
+}
+
+// pauseTarget reads user subscription by name, "all" stands for all subscriptions with zero id
+func (cmd *Command) pauseTarget(name string) (*database.Feed, error) {
+	if strings.EqualFold(name, allFeeds) {
+		return &database.Feed{}, nil
+	}
+
+	return db.GetUserNormalizedFeed(cmd.userID, name)
+}
+
+// mute stops feed updates for a day, available from article buttons only
+func (cmd *Command) mute() (string, error) {
+	if !cmd.callback {
+		return templates.ToText(cmd.lang, "cmd-unknown")
+	}
+
+	feedID, err := strconv.Atoi(cmd.args)
+	if err != nil {
+		return templates.ToText(cmd.lang, "remove-no-rows")
+	}
+
+	feed, err := db.GetUserIDFeed(cmd.userID, feedID)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if feed == nil {
+		return templates.ToText(cmd.lang, "remove-no-rows")
+	}
+
+	until := time.Now().In(cmd.location()).Add(muteDuration)
+	if err = db.Mute(cmd.userID, feed.ID, until); err != nil {
+		return emptyText, err
+	}
+
+	// Feed paused for longer stays paused
+	if feed.Paused && (feed.PausedUntil == nil || feed.PausedUntil.After(until)) {
+		var pausedUntil *time.Time
+		if feed.PausedUntil != nil {
+			at := feed.PausedUntil.In(cmd.location())
+			pausedUntil = &at
+		}
+
+		return templates.ToTextW(cmd.lang, "pause-success", struct {
+			Feed  *database.Feed
+			Until *time.Time
+		}{feed, pausedUntil})
+	}
+
+	return templates.ToTextW(cmd.lang, "mute-success", struct {
+		Feed  *database.Feed
+		Until time.Time
+	}{feed, until})
+}
+
+// save bookmarks delivered article, available from article buttons and replies to articles only
+func (cmd *Command) save() (string, error) {
+	var item *database.FeedItem
+	var err error
+
+	switch {
+	case cmd.callback:
+		item, err = cmd.callbackItem()
+	case cmd.replyTo != nil:
+		item, err = cmd.replyItem()
+	default:
+		return templates.ToText(cmd.lang, "cmd-unknown")
+	}
+
+	if err != nil {
+		return emptyText, err
+	}
+
+	if item == nil {
+		return templates.ToText(cmd.lang, "save-missing")
+	}
+
+	added, err := db.AddBookmark(cmd.userID, *item)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if !added {
+		return templates.ToTextW(cmd.lang, "save-exists", item)
+	}
+
+	return templates.ToTextW(cmd.lang, "save-success", item)
+}
+
+// callbackItem reads feed item from "feedID key" button args
+func (cmd *Command) callbackItem() (*database.FeedItem, error) {
+	args := splitNonEmpty(cmd.args)
+	if len(args) != 2 {
+		return nil, nil
+	}
+
+	feedID, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, nil
+	}
+
+	return db.GetFeedItem(feedID, args[1])
+}
+
+// replyItem reads feed item by the article link of the replied message
+func (cmd *Command) replyItem() (*database.FeedItem, error) {
+	if cmd.replyTo.Entities == nil {
+		return nil, nil
+	}
+
+	for _, entity := range *cmd.replyTo.Entities {
+		if entity.Type == "text_link" && len(entity.URL) > 0 {
+			return db.GetUserURIFeedItem(cmd.userID, entity.URL)
+		}
+	}
+
+	return nil, nil
+}
+
+// saved shows user bookmarks page by page
+func (cmd *Command) saved() (string, error) {
+	page := 1
+	if args := strings.TrimSpace(cmd.args); len(args) > 0 {
+		var err error
+		if page, err = strconv.Atoi(args); err != nil || page < 1 {
+			return templates.ToText(cmd.lang, "saved-validation")
+		}
+	}
+
+	items, total, err := db.GetBookmarks(cmd.userID, (page-1)*savedPageSize, savedPageSize)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if total == 0 {
+		return templates.ToText(cmd.lang, "saved-empty")
+	}
+
+	pages := (total + savedPageSize - 1) / savedPageSize
+	if page > pages {
+		return templates.ToText(cmd.lang, "saved-validation")
+	}
+
+	type savedItem struct {
+		N int
+		database.Bookmark
+	}
+
+	rst := make([]savedItem, len(items))
+	for i, item := range items {
+		rst[i] = savedItem{N: (page-1)*savedPageSize + i + 1, Bookmark: item}
+	}
+
+	next := 0
+	if page < pages {
+		next = page + 1
+	}
+
+	return templates.ToTextW(cmd.lang, "saved-result", struct {
+		Items []savedItem
+		Page  int
+		Pages int
+		Next  int
+	}{rst, page, pages, next})
+}
+
+// unsave removes bookmark by its number in /saved list
+func (cmd *Command) unsave() (string, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(cmd.args))
+	if err != nil || n < 1 {
+		return templates.ToText(cmd.lang, "unsave-validation")
+	}
+
+	item, err := db.DeleteBookmark(cmd.userID, n)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if item == nil {
+		return templates.ToText(cmd.lang, "unsave-no-rows")
+	}
+
+	return templates.ToTextW(cmd.lang, "unsave-success", item)
+}
+
 func (cmd *Command) list() (string, error) {
 	feeds, err := db.GetUserFeeds(cmd.userID)
 
@@ -204,24 +743,207 @@ func (cmd *Command) list() (string, error) {
 		return templates.ToText(cmd.lang, "list-empty")
 	}
 
+	loc := cmd.location()
+	for i := range feeds {
+		feeds[i].LastPub = inLocation(feeds[i].LastPub, loc)
+		feeds[i].Updated = inLocation(feeds[i].Updated, loc)
+		feeds[i].PausedUntil = inLocation(feeds[i].PausedUntil, loc)
+	}
+
 	return templates.ToTextW(cmd.lang, "list-result", feeds)
 }
 
-func addFeed(userID int64, uri string, title string) (*database.Feed, error) {
-	feed, err := db.GetFeed(uri)
+func (cmd *Command) filter() (string, error) {
+	name, rules, _ := strings.Cut(strings.TrimSpace(cmd.args), " ")
+	if len(name) == 0 {
+		return templates.ToText(cmd.lang, "filter-validation")
+	}
+
+	feed, err := db.GetUserNormalizedFeed(cmd.userID, name)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if feed == nil {
+		return templates.ToText(cmd.lang, "remove-no-rows")
+	}
+
+	rules = strings.TrimSpace(rules)
+	if len(rules) == 0 {
+		return templates.ToTextW(cmd.lang, "filter-success", feed)
+	}
+
+	feed.Filters = nil
+	if rules != "clear" {
+		if feed.Filters, err = splitRules(rules); err != nil {
+			return templates.ToText(cmd.lang, "filter-validation")
+		}
+	}
+
+	if err = db.SetFilters(cmd.userID, feed.ID, feed.Filters); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "filter-success", feed)
+}
+
+func (cmd *Command) digest() (string, error) {
+	args := splitNonEmpty(strings.ToLower(cmd.args))
+	if len(args) == 0 {
+		usr, err := db.GetUser(cmd.userID)
+		if err != nil {
+			return emptyText, err
+		}
+
+		if usr == nil {
+			usr = &database.User{ID: cmd.userID, Digest: digestInstant}
+		}
+
+		return templates.ToTextW(cmd.lang, "digest-validation", cmd.toDigestView(usr))
+	}
+
+	usr := &database.User{ID: cmd.userID, Digest: args[0]}
+	switch usr.Digest {
+	case digestInstant, digestHourly:
+		if len(args) > 1 {
+			return templates.ToTextW(cmd.lang, "digest-validation", nil)
+		}
+	case digestDaily:
+		usr.DigestAt = defaultDigestAt
+		if len(args) > 1 {
+			at, err := time.Parse("15:04", args[1])
+			if err != nil || len(args) > 2 {
+				return templates.ToTextW(cmd.lang, "digest-validation", nil)
+			}
+			usr.DigestAt = at.Hour()*60 + at.Minute()
+		}
+	default:
+		return templates.ToTextW(cmd.lang, "digest-validation", nil)
+	}
+
+	if err := db.SetUserDigest(usr.ID, usr.Digest, usr.DigestAt); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "digest-success", cmd.toDigestView(usr))
+}
+
+// digestView is a template friendly representation of the user digest settings
+type digestView struct {
+	Mode string
+	At   string
+	Zone string
+}
+
+func (cmd *Command) toDigestView(usr *database.User) *digestView {
+	return &digestView{Mode: usr.Digest, At: formatMinute(usr.DigestAt), Zone: cmd.location().String()}
+}
+
+// last shows latest feed articles from the stored history, feed is read when history is too short
+func (cmd *Command) last() (string, error) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(cmd.args), " ")
+	if len(name) == 0 {
+		return templates.ToText(cmd.lang, "last-validation")
+	}
+
+	count := lastItems
+	if rest = strings.TrimSpace(rest); len(rest) > 0 {
+		var err error
+		if count, err = strconv.Atoi(rest); err != nil || count < 1 {
+			return templates.ToText(cmd.lang, "last-validation")
+		}
+		count = min(count, maxLastItems)
+	}
+
+	feed, err := db.GetUserNormalizedFeed(cmd.userID, name)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if feed == nil {
+		return templates.ToText(cmd.lang, "remove-no-rows")
+	}
+
+	items, err := db.GetFeedItems(feed.ID, count)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if len(items) < count {
+		topics, _, err := parser.GetUpdates(feed.URI, time.Time{}, parser.Cache{})
+		if err != nil && len(items) == 0 {
+			return emptyText, err
+		}
+
+		if err != nil {
+			log.Printf("WARN Unable to read feed %d for /last, stored items are used: %s", feed.ID, err)
+		} else {
+			items = nil
+			for _, topic := range parser.GetLatest(topics, count) {
+				items = append(items, database.FeedItem{FeedID: feed.ID, Feed: feed.Name, GUID: topic.GUID, Title: topic.Title, URI: topic.URI, Date: topic.Date})
+			}
+		}
+	}
+
+	if len(items) == 0 {
+		return templates.ToTextW(cmd.lang, "last-empty", feed)
+	}
+
+	loc := cmd.location()
+	for i := range items {
+		items[i].Date = inLocation(items[i].Date, loc)
+	}
+
+	return templates.ToTextW(cmd.lang, "last-result", struct {
+		Feed  *database.Feed
+		Items []database.FeedItem
+	}{feed, items})
+}
+
+func (cmd *Command) exportOpml() (string, error) {
+	feeds, err := db.GetUserFeeds(cmd.userID)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if len(feeds) == 0 {
+		return templates.ToText(cmd.lang, "list-empty")
+	}
+
+	var items []parser.OpmlItem
+	for _, feed := range feeds {
+		items = append(items, parser.OpmlItem{Title: feed.Name, URL: feed.URI, Link: feed.Link, Category: feed.Category})
+	}
+
+	data, err := parser.WriteOpml("AddRss subscriptions", items)
+	if err != nil {
+		return emptyText, err
+	}
+
+	name := fmt.Sprintf("addrss-%s.opml", time.Now().Format("2006-01-02"))
+	if err = sendDocument(cmd.userID, name, data); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "export-success", len(items))
+}
+
+func addFeed(userID int64, item parser.OpmlItem) (*database.Feed, error) {
+	feed, err := db.GetFeed(item.URL)
 	if err != nil {
 		return nil, err
 	}
 
 	if feed == nil {
-		if len(title) == 0 {
-			title, err = parser.GetTitle(uri)
+		if len(item.Title) == 0 {
+			info, err := parser.GetInfo(item.URL)
 			if err != nil {
 				return nil, err
 			}
+			item.Title, item.Link = info.Title, info.Link
 		}
 
-		feed, err = db.AddFeed(title, normalize(title), uri)
+		feed, err = db.AddFeed(item.Title, normalize(item.Title), item.URL, item.Link)
 		if err != nil {
 			return nil, err
 		}
@@ -229,7 +951,7 @@ func addFeed(userID int64, uri string, title string) (*database.Feed, error) {
 		_ = db.ResetFeed(feed.ID)
 	}
 
-	err = db.Subscribe(userID, feed.ID)
+	err = db.Subscribe(userID, feed.ID, item.Category)
 	if err != nil {
 		return nil, err
 	}
@@ -237,6 +959,108 @@ func addFeed(userID int64, uri string, title string) (*database.Feed, error) {
 	return feed, nil
 }
 
+// userLang returns language chosen by user or fallback one
+func userLang(userID int64, fallback string) string {
+	lang, _ := userSettings(userID, fallback)
+	return lang
+}
+
+// userSettings returns language chosen by user or fallback one and user timezone
+func userSettings(userID int64, fallback string) (string, string) {
+	usr, err := db.GetUser(userID)
+	if err != nil {
+		log.Printf("WARN Unable to read user %d settings: %s", userID, err)
+		return fallback, emptyText
+	}
+
+	if usr == nil {
+		return fallback, emptyText
+	}
+
+	if len(usr.Lang) == 0 {
+		return fallback, usr.Timezone
+	}
+
+	return usr.Lang, usr.Timezone
+}
+
+// location returns user timezone, UTC by default
+func (cmd *Command) location() *time.Location {
+	return userLocation(cmd.timezone)
+}
+
+func (cmd *Command) setTimezone() (string, error) {
+	name := strings.TrimSpace(cmd.args)
+	if len(name) == 0 || name == "Local" {
+		return templates.ToTextW(cmd.lang, "timezone-validation", cmd.location().String())
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return templates.ToTextW(cmd.lang, "timezone-validation", cmd.location().String())
+	}
+
+	if err = db.SetUserTimezone(cmd.userID, loc.String()); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "timezone-success", struct {
+		Name string
+		Now  string
+	}{loc.String(), time.Now().In(loc).Format("15:04")})
+}
+
+func (cmd *Command) quiet() (string, error) {
+	args := splitNonEmpty(strings.ToLower(cmd.args))
+	if len(args) == 0 {
+		usr, err := db.GetUser(cmd.userID)
+		if err != nil {
+			return emptyText, err
+		}
+
+		var view *quietView
+		if usr != nil && len(usr.Quiet.Mode) > 0 {
+			view = cmd.toQuietView(usr.Quiet)
+		}
+
+		return templates.ToTextW(cmd.lang, "quiet-validation", view)
+	}
+
+	quiet := database.Quiet{}
+	if len(args) != 1 || args[0] != "off" {
+		from, to, ok := parseQuiet(args[0])
+		if !ok || len(args) > 2 {
+			return templates.ToTextW(cmd.lang, "quiet-validation", nil)
+		}
+
+		quiet = database.Quiet{Mode: quietHold, From: from, To: to}
+		if len(args) > 1 {
+			if args[1] != quietHold && args[1] != quietSilent {
+				return templates.ToTextW(cmd.lang, "quiet-validation", nil)
+			}
+			quiet.Mode = args[1]
+		}
+	}
+
+	if err := db.SetUserQuiet(cmd.userID, quiet); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "quiet-success", cmd.toQuietView(quiet))
+}
+
+// quietView is a template friendly representation of the user quiet hours
+type quietView struct {
+	Mode string
+	From string
+	To   string
+	Zone string
+}
+
+func (cmd *Command) toQuietView(quiet database.Quiet) *quietView {
+	return &quietView{Mode: quiet.Mode, From: formatMinute(quiet.From), To: formatMinute(quiet.To), Zone: cmd.location().String()}
+}
+
 func (cmd *Command) feedbackMulti() []Reply {
 	const maxFeedbackLength = 1000
 	var replies []Reply
@@ -253,7 +1077,7 @@ func (cmd *Command) feedbackMulti() []Reply {
 		return replies
 	}
 
-	feedbackText, _ := templates.ToTextW(cmd.lang, "feedback-message", struct {
+	feedbackText, _ := templates.ToTextW(userLang(cmd.adminID, templates.DefaultLang), "feedback-message", struct {
 		UserID  int64
 		Message string
 	}{cmd.userID, cmd.args})
@@ -263,6 +1087,106 @@ func (cmd *Command) feedbackMulti() []Reply {
 	return replies
 }
 
+// channel links channels and manages their subscriptions from the owner private chat
+func (cmd *Command) channel() (string, error) {
+	if cmd.group {
+		return templates.ToText(cmd.lang, "channel-private-only")
+	}
+
+	name, rest, _ := strings.Cut(strings.TrimSpace(cmd.args), " ")
+	verb, args, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	verb = strings.ToLower(verb)
+
+	switch strings.ToLower(name) {
+	case "":
+		channels, err := db.GetChannels(cmd.userID)
+		if err != nil {
+			return emptyText, err
+		}
+
+		return templates.ToTextW(cmd.lang, "channel-validation", channels)
+	case "link":
+		return cmd.linkChannel(channelName(verb))
+	case "unlink":
+		return cmd.unlinkChannel(channelName(verb))
+	}
+
+	if !channelVerbs[verb] {
+		return templates.ToTextW(cmd.lang, "channel-validation", nil)
+	}
+
+	channel, err := db.GetChannel(cmd.userID, channelName(name))
+	if err != nil {
+		return emptyText, err
+	}
+
+	if channel == nil {
+		return templates.ToTextW(cmd.lang, "channel-not-found", channelName(name))
+	}
+
+	sub := &Command{
+		userID:     channel.ChatID,
+		fromID:     cmd.fromID,
+		adminID:    cmd.adminID,
+		verb:       verb,
+		args:       strings.TrimSpace(args),
+		lang:       cmd.lang,
+		raw:        cmd.raw,
+		forChannel: channel.Name,
+		replyQueue: cmd.replyQueue,
+	}
+
+	var texts []string
+	for _, reply := range sub.run() {
+		texts = append(texts, reply.Text)
+	}
+
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// linkChannel checks that both user and bot are channel administrators and links channel to the user
+func (cmd *Command) linkChannel(name string) (string, error) {
+	chat, err := getChannel(name)
+	if err != nil || !chat.IsChannel() {
+		log.Printf("WARN User %d unable to link channel '%s': %v", cmd.userID, name, err)
+		return templates.ToTextW(cmd.lang, "channel-not-found", name)
+	}
+
+	if !chatAdmin(chat.ID, cmd.fromID) {
+		return templates.ToTextW(cmd.lang, "channel-not-admin", name)
+	}
+
+	member, err := getBotMember(chat.ID)
+	if err != nil || !(member.IsCreator() || member.CanPostMessages) {
+		return templates.ToTextW(cmd.lang, "channel-no-rights", name)
+	}
+
+	channel := database.Channel{ChatID: chat.ID, OwnerID: cmd.userID, Name: channelName(chat.UserName)}
+	if err = db.AddChannel(channel); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "channel-linked", channel)
+}
+
+// unlinkChannel drops channel link with all its subscriptions
+func (cmd *Command) unlinkChannel(name string) (string, error) {
+	channel, err := db.GetChannel(cmd.userID, name)
+	if err != nil {
+		return emptyText, err
+	}
+
+	if channel == nil {
+		return templates.ToTextW(cmd.lang, "channel-not-found", name)
+	}
+
+	if err = db.DeleteUser(channel.ChatID); err != nil {
+		return emptyText, err
+	}
+
+	return templates.ToTextW(cmd.lang, "channel-unlinked", channel)
+}
+
 func (cmd *Command) notifyMulti() []Reply {
 	const maxNotifyLength = 2000
 	var replies []Reply
@@ -285,23 +1209,29 @@ func (cmd *Command) notifyMulti() []Reply {
 		return replies
 	}
 
-	userIDs, err := db.GetAllUsers()
+	users, err := db.GetAllUsers()
 	if err != nil {
 		text, _ := templates.ToText(cmd.lang, "notify-error")
 		replies = append(replies, Reply{ChatID: cmd.userID, Text: text})
 		return replies
 	}
 
-	notificationText, _ := templates.ToTextW(cmd.lang, "notify-message", struct {
-		Message string
-	}{cmd.args})
-	for _, userID := range userIDs {
-		replies = append(replies, Reply{ChatID: userID, Text: notificationText})
+	texts := make(map[string]string)
+	for _, usr := range users {
+		notificationText, ok := texts[usr.Lang]
+		if !ok {
+			notificationText, _ = templates.ToTextW(usr.Lang, "notify-message", struct {
+				Message string
+			}{cmd.args})
+			texts[usr.Lang] = notificationText
+		}
+
+		replies = append(replies, Reply{ChatID: usr.ID, Text: notificationText})
 	}
 
 	summary, _ := templates.ToTextW(cmd.lang, "notify-success", struct {
 		Total int
-	}{len(userIDs)})
+	}{len(users)})
 	replies = append(replies, Reply{ChatID: cmd.userID, Text: summary})
 	return replies
 }
@@ -2,11 +2,16 @@ package server
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/vladikan/addrss-telegram/database"
+	"github.com/vladikan/addrss-telegram/parser"
 	"github.com/vladikan/addrss-telegram/templates"
 )
 
@@ -43,10 +48,70 @@ func TestStats_Success(t *testing.T) {
 
 func TestStart(t *testing.T) {
 	exp := "start-success"
+	stored := ""
+	db = &dbMock{
+		getUserMock:     func() (*database.User, error) { return nil, nil },
+		setUserLangMock: func() error { stored = "set"; return nil },
+	}
+
+	r, err := (&Command{lang: "RU"}).start()
+	assertTemplate(t, r, exp, err)
+	if stored != "set" {
+		t.Errorf("Expected language to be stored on start")
+	}
+}
+
+func TestStart_KeepsChosenLang(t *testing.T) {
+	exp := "start-success"
+	db = &dbMock{
+		getUserMock:     func() (*database.User, error) { return &database.User{Lang: "en"}, nil },
+		setUserLangMock: func() error { t.Errorf("Language should not be overwritten"); return nil },
+	}
+
+	r, err := (&Command{lang: "ru"}).start()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestStart_ErrorOnRead(t *testing.T) {
+	exp := errors.New("test")
+	db = &dbMock{
+		getUserMock: func() (*database.User, error) { return nil, exp },
+	}
+
 	r, err := (&Command{}).start()
+	assertError(t, r, err, exp)
+}
+
+func TestLang_Unsupported(t *testing.T) {
+	exp := "lang-validation"
+	r, err := (&Command{args: "xx"}).setLang()
 	assertTemplate(t, r, exp, err)
 }
 
+func TestLang_ErrorOnUpdate(t *testing.T) {
+	exp := errors.New("test")
+	db = &dbMock{
+		setUserLangMock: func() error { return exp },
+	}
+
+	r, err := (&Command{args: "ru"}).setLang()
+	assertError(t, r, err, exp)
+}
+
+func TestLang_Success(t *testing.T) {
+	exp := "lang-success"
+	db = &dbMock{
+		setUserLangMock: func() error { return nil },
+	}
+
+	cmd := &Command{args: " RU ", lang: "en"}
+	r, err := cmd.setLang()
+	assertTemplate(t, r, exp, err)
+	if cmd.lang != "ru" {
+		t.Errorf("Expected 'ru' language, but was '%s'", cmd.lang)
+	}
+}
+
 func TestHelp(t *testing.T) {
 	exp := "help-success"
 	r, err := (&Command{}).help()
@@ -116,6 +181,252 @@ func TestAdd_SubscribeToExisting(t *testing.T) {
 	assertTemplate(t, r, exp, err)
 }
 
+func TestAdd_DiscoverSingle(t *testing.T) {
+	exp := "add-success"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.rss" {
+			w.Write([]byte(`<rss version="2.0"><channel><title>Test</title></channel></rss>`))
+			return
+		}
+		w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" href="/feed.rss"></head></html>`))
+	}))
+	defer srv.Close()
+
+	lookups := 0
+	db = &dbMock{
+		getUserURIFeedMock: func() (*database.Feed, error) { lookups++; return nil, nil },
+		getFeedMock:        func() (*database.Feed, error) { return nil, nil },
+		addFeedMock:        func() (*database.Feed, error) { return &database.Feed{}, nil },
+		subscribeMock:      func() error { return nil },
+	}
+
+	r, err := (&Command{args: srv.URL}).add()
+	assertTemplate(t, r, exp, err)
+
+	if lookups != 2 {
+		t.Errorf("Expected discovered feed to be checked in subscriptions, but was %d lookups", lookups)
+	}
+}
+
+func TestAdd_DiscoverNotFound(t *testing.T) {
+	exp := "add-not-found"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`<html><head></head><body></body></html>`))
+	}))
+	defer srv.Close()
+
+	db = &dbMock{
+		getUserURIFeedMock: func() (*database.Feed, error) { return nil, nil },
+		getFeedMock:        func() (*database.Feed, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: srv.URL}).add()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestAdd_DiscoverChoice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head>
+<link rel="alternate" type="application/rss+xml" title="Posts" href="/posts.rss">
+<link rel="alternate" type="application/atom+xml" title="Comments" href="/comments.atom">
+</head></html>`))
+	}))
+	defer srv.Close()
+
+	db = &dbMock{
+		getUserURIFeedMock: func() (*database.Feed, error) { return nil, nil },
+		getFeedMock:        func() (*database.Feed, error) { return nil, nil },
+	}
+
+	cmd := &Command{userID: 1, args: srv.URL}
+	r, err := cmd.add()
+	assertTemplate(t, r, "add-choice", err)
+
+	if cmd.markup == nil || len(cmd.markup.InlineKeyboard) != 2 {
+		t.Fatalf("Expected keyboard with 2 feeds, but was %+v", cmd.markup)
+	}
+
+	data, ok := verifyCallback(1, *cmd.markup.InlineKeyboard[1][0].CallbackData)
+	_, key, _ := strings.Cut(data, " ")
+	if uri, found := sources.get(key); !ok || !found || uri != srv.URL+"/comments.atom" {
+		t.Errorf("Expected button for comments feed, but was '%s'", data)
+	}
+}
+
+func TestChannel_AddChoice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head>
+<link rel="alternate" type="application/rss+xml" title="Posts" href="/posts.rss">
+<link rel="alternate" type="application/atom+xml" title="Comments" href="/comments.atom">
+</head></html>`))
+	}))
+	defer srv.Close()
+
+	db = &dbMock{
+		getChannelMock:     func() (*database.Channel, error) { return &database.Channel{ChatID: -100, Name: "@news"}, nil },
+		getUserMock:        func() (*database.User, error) { return nil, nil },
+		getUserURIFeedMock: func() (*database.Feed, error) { return nil, nil },
+		getFeedMock:        func() (*database.Feed, error) { return nil, nil },
+	}
+
+	r, err := (&Command{userID: 1, args: "@news add " + srv.URL, raw: &tgbotapi.Message{}}).channel()
+	assertTemplate(t, r, "channel-add-choice", err)
+}
+
+func TestAdd_CallbackExpired(t *testing.T) {
+	exp := "add-expired"
+	r, err := (&Command{args: "unknown", callback: true}).add()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestAdd_Callback(t *testing.T) {
+	exp := "add-success"
+	uri := "https://example.com/feed.rss"
+	db = &dbMock{
+		getUserURIFeedMock: func() (*database.Feed, error) { return nil, nil },
+		getFeedMock:        func() (*database.Feed, error) { return &database.Feed{}, nil },
+		resetFeedMock:      func() error { return nil },
+		subscribeMock:      func() error { return nil },
+	}
+
+	r, err := (&Command{args: sources.put(uri), callback: true}).add()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestPreview_NoArgs(t *testing.T) {
+	exp := "preview-validation"
+	r, err := (&Command{}).preview()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestPreview_Success(t *testing.T) {
+	exp := "preview-success"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss version="2.0"><channel><title>Test</title>
+<item><title>1</title><link>https://example.com/1</link></item></channel></rss>`))
+	}))
+	defer srv.Close()
+
+	// Nothing is written till user presses the subscribe button
+	db = &dbMock{}
+
+	cmd := &Command{userID: 1, args: srv.URL}
+	r, err := cmd.preview()
+	assertTemplate(t, r, exp, err)
+
+	if cmd.markup == nil || len(cmd.markup.InlineKeyboard) != 1 {
+		t.Fatalf("Expected subscribe button, but was %+v", cmd.markup)
+	}
+
+	data, ok := verifyCallback(1, *cmd.markup.InlineKeyboard[0][0].CallbackData)
+	verb, key, _ := strings.Cut(data, " ")
+	if uri, found := sources.get(key); !ok || verb != "add" || !found || uri != srv.URL {
+		t.Errorf("Expected button to add previewed feed, but was '%s'", data)
+	}
+}
+
+func TestLast_Validation(t *testing.T) {
+	exp := "last-validation"
+	for _, args := range []string{"", "name zero", "name 0"} {
+		r, err := (&Command{args: args}).last()
+		assertTemplate(t, r, exp, err)
+	}
+}
+
+func TestLast_NoFeed(t *testing.T) {
+	exp := "remove-no-rows"
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "name"}).last()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestLast_StoredItems(t *testing.T) {
+	exp := "last-result"
+	items := []database.FeedItem{{Title: "1"}, {Title: "2"}}
+	db = &dbMock{
+		getUserMock:               func() (*database.User, error) { return nil, nil },
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return &database.Feed{URI: "http://127.0.0.1:0"}, nil },
+		getFeedItemsMock:          func() ([]database.FeedItem, error) { return items, nil },
+	}
+
+	r, err := (&Command{args: "name 2"}).last()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestLast_ReadFeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss version="2.0"><channel><title>Test</title></channel></rss>`))
+	}))
+	defer srv.Close()
+
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return &database.Feed{URI: srv.URL}, nil },
+		getFeedItemsMock:          func() ([]database.FeedItem, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "name"}).last()
+	assertTemplate(t, r, "last-empty", err)
+
+	srv.Close()
+	r, err = (&Command{args: "name"}).last()
+	if err == nil {
+		t.Errorf("Expected feed read error, but was '%s'", r)
+	}
+}
+
+func TestImportFeeds_SkipReasons(t *testing.T) {
+	calls := 0
+	db = &dbMock{
+		getFeedMock:   func() (*database.Feed, error) { return &database.Feed{}, nil },
+		resetFeedMock: func() error { return nil },
+		subscribeMock: func() error {
+			calls++
+			if calls == 2 {
+				return errors.New("test")
+			}
+			return nil
+		},
+	}
+
+	items := []parser.OpmlItem{
+		{Title: "ok", URL: "http://example.com/rss"},
+		{Title: "dup", URL: "http://example.com/rss"},
+		{Title: "bad", URL: "example.com/rss"},
+		{Title: "err", URL: "https://example.com/atom"},
+	}
+
+	r := importFeeds(1, items)
+	if r.Added != 1 || r.Errors != 3 {
+		t.Errorf("Expected 1 added and 3 errors, but was %d and %d", r.Added, r.Errors)
+	}
+
+	exp := []string{skipDuplicate, skipInvalid, skipError}
+	for i, reason := range exp {
+		if r.Skipped[i].Reason != reason {
+			t.Errorf("Expected '%s' reason, but was '%s'", reason, r.Skipped[i].Reason)
+		}
+	}
+}
+
+func TestImportFeeds_LimitReport(t *testing.T) {
+	var items []parser.OpmlItem
+	for i := 0; i < maxSkippedReport+5; i++ {
+		items = append(items, parser.OpmlItem{URL: "bad"})
+	}
+
+	r := importFeeds(1, items)
+	if len(r.Skipped) != maxSkippedReport || r.More != 5 {
+		t.Errorf("Expected %d reported and 5 more, but was %d and %d", maxSkippedReport, len(r.Skipped), r.More)
+	}
+}
+
 func TestRemove_NoArgs(t *testing.T) {
 	exp := "remove-validation"
 	r, err := (&Command{}).remove()
@@ -164,6 +475,464 @@ func TestRemove_Unsubscribed(t *testing.T) {
 	assertTemplate(t, r, exp, err)
 }
 
+func TestUnsubscribe_BadID(t *testing.T) {
+	exp := "remove-no-rows"
+	r, err := (&Command{args: "name"}).unsubscribe()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestUnsubscribe_Unsubscribed(t *testing.T) {
+	exp := "remove-success"
+	db = &dbMock{
+		getUserIDFeedMock: func() (*database.Feed, error) { return &database.Feed{}, nil },
+		unsubscribeMock:   func() error { return nil },
+	}
+
+	r, err := (&Command{args: "1"}).unsubscribe()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestTimezone_Validation(t *testing.T) {
+	exp := "timezone-validation"
+	for _, args := range []string{"", "Local", "Mars/Olympus"} {
+		r, err := (&Command{args: args}).setTimezone()
+		assertTemplate(t, r, exp, err)
+	}
+}
+
+func TestTimezone_Success(t *testing.T) {
+	exp := "timezone-success"
+	stored := ""
+	db = &dbMock{
+		setUserTimezoneMock: func() error { stored = "set"; return nil },
+	}
+
+	r, err := (&Command{args: "Europe/Berlin"}).setTimezone()
+	assertTemplate(t, r, exp, err)
+	if stored != "set" {
+		t.Errorf("Expected timezone to be stored")
+	}
+}
+
+func TestQuiet_Current(t *testing.T) {
+	exp := "quiet-validation"
+	db = &dbMock{
+		getUserMock: func() (*database.User, error) { return nil, nil },
+	}
+
+	r, err := (&Command{}).quiet()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestQuiet_Validation(t *testing.T) {
+	exp := "quiet-validation"
+	for _, args := range []string{"23:00", "23:00-08:00 loud", "23:00-08:00 hold more", "off now"} {
+		r, err := (&Command{args: args}).quiet()
+		assertTemplate(t, r, exp, err)
+	}
+}
+
+func TestQuiet_Success(t *testing.T) {
+	exp := "quiet-success"
+	db = &dbMock{
+		setUserQuietMock: func() error { return nil },
+	}
+
+	for _, args := range []string{"23:00-08:00", "23:00-08:00 silent", "off"} {
+		r, err := (&Command{args: args}).quiet()
+		assertTemplate(t, r, exp, err)
+	}
+}
+
+func TestPause_Validation(t *testing.T) {
+	exp := "pause-validation"
+	for _, args := range []string{"", "name 3x", "name 0d", "name 1d more"} {
+		r, err := (&Command{args: args}).pause()
+		assertTemplate(t, r, exp, err)
+	}
+}
+
+func TestPause_NotSubscribed(t *testing.T) {
+	exp := "remove-no-rows"
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "name 3d"}).pause()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestPause_All(t *testing.T) {
+	exp := "pause-success"
+	feedID := -1
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { t.Errorf("Feed should not be read for all"); return nil, nil },
+		pauseMock:                 func() error { feedID = 0; return nil },
+	}
+
+	r, err := (&Command{args: "ALL"}).pause()
+	assertTemplate(t, r, exp, err)
+	if feedID != 0 {
+		t.Errorf("Expected all subscriptions to be paused")
+	}
+}
+
+func TestPause_ErrorOnUpdate(t *testing.T) {
+	exp := errors.New("test")
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return &database.Feed{ID: 1}, nil },
+		pauseMock:                 func() error { return exp },
+	}
+
+	r, err := (&Command{args: "name 12h"}).pause()
+	assertError(t, r, err, exp)
+}
+
+func TestResume_Validation(t *testing.T) {
+	exp := "resume-validation"
+	r, err := (&Command{}).resume()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestResume_Resumed(t *testing.T) {
+	exp := "resume-success"
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return &database.Feed{ID: 1}, nil },
+		resumeMock:                func() error { return nil },
+	}
+
+	r, err := (&Command{args: "name"}).resume()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestMute_NotCallback(t *testing.T) {
+	exp := "cmd-unknown"
+	r, err := (&Command{args: "1"}).mute()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestMute_NotSubscribed(t *testing.T) {
+	exp := "remove-no-rows"
+	db = &dbMock{
+		getUserIDFeedMock: func() (*database.Feed, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "1", callback: true}).mute()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestMute_Muted(t *testing.T) {
+	exp := "mute-success"
+	muted := false
+	db = &dbMock{
+		getUserIDFeedMock: func() (*database.Feed, error) { return &database.Feed{ID: 1}, nil },
+		muteMock:          func() error { muted = true; return nil },
+	}
+
+	r, err := (&Command{args: "1", callback: true}).mute()
+	assertTemplate(t, r, exp, err)
+	if !muted {
+		t.Errorf("Expected feed to be muted")
+	}
+}
+
+func TestMute_KeepsLongerPause(t *testing.T) {
+	exp := "pause-success"
+	week := time.Now().Add(7 * 24 * time.Hour)
+	for _, feed := range []*database.Feed{{ID: 1, Paused: true}, {ID: 1, Paused: true, PausedUntil: &week}} {
+		db = &dbMock{
+			getUserIDFeedMock: func() (*database.Feed, error) { return feed, nil },
+			muteMock:          func() error { return nil },
+		}
+
+		r, err := (&Command{args: "1", callback: true}).mute()
+		assertTemplate(t, r, exp, err)
+	}
+}
+
+func TestSave_NotCallback(t *testing.T) {
+	exp := "cmd-unknown"
+	r, err := (&Command{args: "1 abc"}).save()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSave_Missing(t *testing.T) {
+	exp := "save-missing"
+	db = &dbMock{
+		getFeedItemMock: func() (*database.FeedItem, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "1 abc", callback: true}).save()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSave_Saved(t *testing.T) {
+	exp := "save-success"
+	db = &dbMock{
+		getFeedItemMock: func() (*database.FeedItem, error) { return &database.FeedItem{}, nil },
+		addBookmarkMock: func() (bool, error) { return true, nil },
+	}
+
+	r, err := (&Command{args: "1 abc", callback: true}).save()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSave_Exists(t *testing.T) {
+	exp := "save-exists"
+	db = &dbMock{
+		getFeedItemMock: func() (*database.FeedItem, error) { return &database.FeedItem{}, nil },
+		addBookmarkMock: func() (bool, error) { return false, nil },
+	}
+
+	r, err := (&Command{args: "1 abc", callback: true}).save()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSave_Reply(t *testing.T) {
+	exp := "save-success"
+	db = &dbMock{
+		getUserURIFeedItemMock: func() (*database.FeedItem, error) { return &database.FeedItem{}, nil },
+		addBookmarkMock:        func() (bool, error) { return true, nil },
+	}
+
+	reply := &tgbotapi.Message{Entities: &[]tgbotapi.MessageEntity{{Type: "bold"}, {Type: "text_link", URL: "https://example.com/1"}}}
+	r, err := (&Command{replyTo: reply}).save()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSave_ReplyWithoutLink(t *testing.T) {
+	exp := "save-missing"
+	r, err := (&Command{replyTo: &tgbotapi.Message{Text: "text"}}).save()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestNewCommand_ReplySave(t *testing.T) {
+	msg := &tgbotapi.Message{
+		Text:           " Save ",
+		From:           &tgbotapi.User{},
+		Chat:           &tgbotapi.Chat{ID: 1},
+		ReplyToMessage: &tgbotapi.Message{Text: "topic"},
+	}
+
+	cmd := newCommand(msg, &Options{}, nil)
+	if cmd.verb != "save" || cmd.replyTo == nil {
+		t.Errorf("Expected reply to be save command, but was '%s'", cmd.verb)
+	}
+}
+
+func TestNewCommand_Group(t *testing.T) {
+	group := &tgbotapi.Chat{ID: -1, Type: "supergroup"}
+	cases := []struct {
+		msg *tgbotapi.Message
+		exp bool
+	}{
+		{&tgbotapi.Message{Text: "hello", From: &tgbotapi.User{}, Chat: group}, false},
+		{&tgbotapi.Message{Document: &tgbotapi.Document{FileID: "1"}, From: &tgbotapi.User{}, Chat: group}, false},
+		{&tgbotapi.Message{Document: &tgbotapi.Document{FileID: "1"}, Caption: "/import", From: &tgbotapi.User{}, Chat: group}, true},
+		{&tgbotapi.Message{Text: "/list", Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Length: 5}}, From: &tgbotapi.User{}, Chat: group}, true},
+	}
+
+	for i, c := range cases {
+		if cmd := newCommand(c.msg, &Options{}, nil); (cmd != nil) != c.exp {
+			t.Errorf("[%d] Expected command '%v', but was %+v", i, c.exp, cmd)
+		}
+	}
+}
+
+func TestRun_GroupAdminOnly(t *testing.T) {
+	defer func(saved func(int64, int) (tgbotapi.ChatMember, error)) { getChatMember = saved }(getChatMember)
+	getChatMember = func(int64, int) (tgbotapi.ChatMember, error) { return tgbotapi.ChatMember{Status: "member"}, nil }
+	db = &dbMock{
+		getUserMock:      func() (*database.User, error) { return nil, nil },
+		getUserFeedsMock: func() ([]database.Feed, error) { return nil, nil },
+	}
+
+	cmd := &Command{userID: -1, group: true, verb: "add", args: "https://example.com/rss", raw: &tgbotapi.Message{}}
+	assertReplyTemplate(t, cmd.run()[0], "group-admin-only")
+
+	cmd = &Command{userID: -1, group: true, verb: "list", raw: &tgbotapi.Message{}}
+	assertReplyTemplate(t, cmd.run()[0], "list-empty")
+}
+
+func TestRun_GroupAdminOnlyBookmarks(t *testing.T) {
+	defer func(saved func(int64, int) (tgbotapi.ChatMember, error)) { getChatMember = saved }(getChatMember)
+	getChatMember = func(int64, int) (tgbotapi.ChatMember, error) { return tgbotapi.ChatMember{Status: "member"}, nil }
+	db = &dbMock{
+		getUserMock: func() (*database.User, error) { return nil, nil },
+	}
+
+	for _, verb := range []string{"save", "unsave"} {
+		cmd := &Command{userID: -1, group: true, verb: verb, args: "1", raw: &tgbotapi.Message{}}
+		assertReplyTemplate(t, cmd.run()[0], "group-admin-only")
+	}
+}
+
+func TestChannel_PrivateOnly(t *testing.T) {
+	exp := "channel-private-only"
+	r, err := (&Command{group: true, args: "link @news"}).channel()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestChannel_List(t *testing.T) {
+	exp := "channel-validation"
+	db = &dbMock{
+		getChannelsMock: func() ([]database.Channel, error) { return []database.Channel{{Name: "@news"}}, nil },
+	}
+
+	r, err := (&Command{}).channel()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestChannel_Link(t *testing.T) {
+	defer func(member func(int64, int) (tgbotapi.ChatMember, error), botMember func(int64) (tgbotapi.ChatMember, error), channel func(string) (tgbotapi.Chat, error)) {
+		getChatMember, getBotMember, getChannel = member, botMember, channel
+	}(getChatMember, getBotMember, getChannel)
+
+	getChannel = func(string) (tgbotapi.Chat, error) { return tgbotapi.Chat{ID: -100, Type: "channel", UserName: "news"}, nil }
+	getChatMember = func(int64, int) (tgbotapi.ChatMember, error) { return tgbotapi.ChatMember{Status: "creator"}, nil }
+	getBotMember = func(int64) (tgbotapi.ChatMember, error) { return tgbotapi.ChatMember{Status: "member"}, nil }
+
+	r, err := (&Command{args: "link @news"}).channel()
+	assertTemplate(t, r, "channel-no-rights", err)
+
+	getBotMember = func(int64) (tgbotapi.ChatMember, error) {
+		return tgbotapi.ChatMember{Status: "administrator", CanPostMessages: true}, nil
+	}
+	db = &dbMock{
+		addChannelMock: func() error { return nil },
+	}
+
+	r, err = (&Command{args: "link news"}).channel()
+	assertTemplate(t, r, "channel-linked", err)
+
+	getChatMember = func(int64, int) (tgbotapi.ChatMember, error) { return tgbotapi.ChatMember{Status: "member"}, nil }
+	r, err = (&Command{args: "link @news"}).channel()
+	assertTemplate(t, r, "channel-not-admin", err)
+
+	getChannel = func(string) (tgbotapi.Chat, error) { return tgbotapi.Chat{ID: 1, Type: "private"}, nil }
+	r, err = (&Command{args: "link @news"}).channel()
+	assertTemplate(t, r, "channel-not-found", err)
+}
+
+func TestChannel_Unlink(t *testing.T) {
+	deleted := false
+	db = &dbMock{
+		getChannelMock: func() (*database.Channel, error) { return &database.Channel{ChatID: -100}, nil },
+		deleteUserMock: func() error { deleted = true; return nil },
+	}
+
+	r, err := (&Command{args: "unlink @news"}).channel()
+	assertTemplate(t, r, "channel-unlinked", err)
+	if !deleted {
+		t.Errorf("Expected channel subscriptions to be deleted")
+	}
+}
+
+func TestChannel_Command(t *testing.T) {
+	db = &dbMock{
+		getChannelMock:   func() (*database.Channel, error) { return &database.Channel{ChatID: -100}, nil },
+		getUserMock:      func() (*database.User, error) { return nil, nil },
+		getUserFeedsMock: func() ([]database.Feed, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "@news list", raw: &tgbotapi.Message{}}).channel()
+	assertTemplate(t, r, "list-empty", err)
+
+	r, err = (&Command{args: "@news feedback hello"}).channel()
+	assertTemplate(t, r, "channel-validation", err)
+}
+
+func TestChannel_NotLinked(t *testing.T) {
+	exp := "channel-not-found"
+	db = &dbMock{
+		getChannelMock: func() (*database.Channel, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "@news list"}).channel()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSaved_Empty(t *testing.T) {
+	exp := "saved-empty"
+	db = &dbMock{
+		getBookmarksMock: func() ([]database.Bookmark, int, error) { return nil, 0, nil },
+	}
+
+	r, err := (&Command{}).saved()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSaved_BadPage(t *testing.T) {
+	exp := "saved-validation"
+	r, err := (&Command{args: "first"}).saved()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSaved_PageOutOfRange(t *testing.T) {
+	exp := "saved-validation"
+	db = &dbMock{
+		getBookmarksMock: func() ([]database.Bookmark, int, error) { return nil, 5, nil },
+	}
+
+	r, err := (&Command{args: "2"}).saved()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestSaved_Result(t *testing.T) {
+	exp := "saved-result"
+	db = &dbMock{
+		getBookmarksMock: func() ([]database.Bookmark, int, error) { return []database.Bookmark{{Title: "test"}}, 11, nil },
+	}
+
+	r, err := (&Command{args: "2"}).saved()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestUnsave_BadNumber(t *testing.T) {
+	exp := "unsave-validation"
+	r, err := (&Command{args: "0"}).unsave()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestUnsave_NoRows(t *testing.T) {
+	exp := "unsave-no-rows"
+	db = &dbMock{
+		deleteBookmarkMock: func() (*database.Bookmark, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "3"}).unsave()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestUnsave_Removed(t *testing.T) {
+	exp := "unsave-success"
+	db = &dbMock{
+		deleteBookmarkMock: func() (*database.Bookmark, error) { return &database.Bookmark{}, nil },
+	}
+
+	r, err := (&Command{args: "1"}).unsave()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestNewCallbackCommand_Forged(t *testing.T) {
+	callbackKey = []byte("test")
+	query := &tgbotapi.CallbackQuery{
+		Data:    "unsubscribe 1 forged",
+		From:    &tgbotapi.User{},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}},
+	}
+
+	if cmd := newCallbackCommand(query, &Options{}, nil); cmd != nil {
+		t.Errorf("Expected forged callback to be rejected")
+	}
+
+	query.Data = *newButton(1, "text", "unsubscribe", "1").CallbackData
+	cmd := newCallbackCommand(query, &Options{}, nil)
+	if cmd == nil || cmd.verb != "unsubscribe" || cmd.args != "1" || !cmd.callback {
+		t.Errorf("Expected signed 'unsubscribe 1' callback, but was %+v", cmd)
+	}
+}
+
 func TestList_ErrorOnRead(t *testing.T) {
 	exp := errors.New("test")
 	db = &dbMock{
@@ -200,6 +969,120 @@ func TestList_ListFeeds(t *testing.T) {
 	assertTemplate(t, r, exp, err)
 }
 
+func TestExport_ErrorOnRead(t *testing.T) {
+	exp := errors.New("test")
+	db = &dbMock{
+		getUserFeedsMock: func() ([]database.Feed, error) {
+			return nil, exp
+		},
+	}
+
+	r, err := (&Command{}).exportOpml()
+	assertError(t, r, err, exp)
+}
+
+func TestExport_EmptyFeeds(t *testing.T) {
+	exp := "list-empty"
+	db = &dbMock{
+		getUserFeedsMock: func() ([]database.Feed, error) {
+			return []database.Feed{}, nil
+		},
+	}
+
+	r, err := (&Command{}).exportOpml()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestDigest_ShowCurrent(t *testing.T) {
+	exp := "digest-validation"
+	db = &dbMock{
+		getUserMock: func() (*database.User, error) { return nil, nil },
+	}
+
+	r, err := (&Command{}).digest()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestDigest_UnknownMode(t *testing.T) {
+	exp := "digest-validation"
+	r, err := (&Command{args: "weekly"}).digest()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestDigest_BadTime(t *testing.T) {
+	exp := "digest-validation"
+	r, err := (&Command{args: "daily 25:00"}).digest()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestDigest_ErrorOnSave(t *testing.T) {
+	exp := errors.New("test")
+	db = &dbMock{
+		setUserDigestMock: func() error { return exp },
+	}
+
+	r, err := (&Command{args: "hourly"}).digest()
+	assertError(t, r, err, exp)
+}
+
+func TestDigest_Success(t *testing.T) {
+	exp := "digest-success"
+	db = &dbMock{
+		setUserDigestMock: func() error { return nil },
+	}
+
+	r, err := (&Command{args: "daily 08:30"}).digest()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestFilter_NoArgs(t *testing.T) {
+	exp := "filter-validation"
+	r, err := (&Command{}).filter()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestFilter_NoRows(t *testing.T) {
+	exp := "remove-no-rows"
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return nil, nil },
+	}
+
+	r, err := (&Command{args: "name +go"}).filter()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestFilter_InvalidRules(t *testing.T) {
+	exp := "filter-validation"
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return &database.Feed{}, nil },
+	}
+
+	r, err := (&Command{args: "name /(/"}).filter()
+	assertTemplate(t, r, exp, err)
+}
+
+func TestFilter_ErrorOnSave(t *testing.T) {
+	exp := errors.New("test")
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return &database.Feed{}, nil },
+		setFiltersMock:            func() error { return exp },
+	}
+
+	r, err := (&Command{args: "name +go -java"}).filter()
+	assertError(t, r, err, exp)
+}
+
+func TestFilter_Success(t *testing.T) {
+	exp := "filter-success"
+	db = &dbMock{
+		getUserNormalizedFeedMock: func() (*database.Feed, error) { return &database.Feed{}, nil },
+		setFiltersMock:            func() error { return nil },
+	}
+
+	r, err := (&Command{args: "name clear"}).filter()
+	assertTemplate(t, r, exp, err)
+}
+
 // Feedback command tests
 func TestFeedback_NoArgs(t *testing.T) {
 	exp := "feedback-validation"
@@ -228,6 +1111,9 @@ func TestFeedback_Success(t *testing.T) {
 	cmd.args = "This is test feedback"
 	cmd.userID = 12345
 	cmd.adminID = 99999
+	db = &dbMock{
+		getUserMock: func() (*database.User, error) { return nil, nil },
+	}
 
 	replies := cmd.feedbackMulti()
 	// First reply is to admin, second is to user
@@ -293,7 +1179,7 @@ func TestNotify_TooLong(t *testing.T) {
 func TestNotify_ErrorOnGetUsers(t *testing.T) {
 	exp := "notify-error"
 	db = &dbMock{
-		getAllUsersMock: func() ([]int64, error) {
+		getAllUsersMock: func() ([]database.User, error) {
 			return nil, errors.New("database error")
 		},
 	}
@@ -307,10 +1193,10 @@ func TestNotify_ErrorOnGetUsers(t *testing.T) {
 
 func TestNotify_Success(t *testing.T) {
 	exp := "notify-success"
-	userIDs := []int64{123, 456, 789}
+	users := []database.User{{ID: 123}, {ID: 456, Lang: "ru"}, {ID: 789}}
 	db = &dbMock{
-		getAllUsersMock: func() ([]int64, error) {
-			return userIDs, nil
+		getAllUsersMock: func() ([]database.User, error) {
+			return users, nil
 		},
 	}
 
@@ -322,10 +1208,10 @@ func TestNotify_Success(t *testing.T) {
 	// The last reply is the summary to the admin
 	assertReplyTemplate(t, replies[len(replies)-1], exp)
 	// The rest should be notifications to users
-	for i, userID := range userIDs {
+	for i, usr := range users {
 		reply := replies[i]
-		if reply.ChatID != userID {
-			t.Errorf("Expected ChatID %d, got %d", userID, reply.ChatID)
+		if reply.ChatID != usr.ID {
+			t.Errorf("Expected ChatID %d, got %d", usr.ID, reply.ChatID)
 		}
 		// Check that users receive the notify-message template
 		if reply.Text != "notify-message" {
@@ -337,8 +1223,8 @@ func TestNotify_Success(t *testing.T) {
 func TestNotify_EmptyUsers(t *testing.T) {
 	exp := "notify-success"
 	db = &dbMock{
-		getAllUsersMock: func() ([]int64, error) {
-			return []int64{}, nil
+		getAllUsersMock: func() ([]database.User, error) {
+			return []database.User{}, nil
 		},
 	}
 
@@ -411,29 +1297,95 @@ type dbMock struct {
 	getStatsMock              func() (*database.Stats, error)
 	addFeedMock               func() (*database.Feed, error)
 	subscribeMock             func() error
+	setFiltersMock            func() error
+	pauseMock                 func() error
+	muteMock                  func() error
+	resumeMock                func() error
 	unsubscribeMock           func() error
 	deleteUserMock            func() error
+	getUserMock               func() (*database.User, error)
+	setUserLangMock           func() error
+	setUserTimezoneMock       func() error
+	setUserQuietMock          func() error
+	setUserDigestMock         func() error
+	setUserDigestedMock       func() error
+	addDigestItemMock         func() error
+	getDigestUsersMock        func() ([]database.User, error)
+	getDigestItemsMock        func() ([]database.DigestItem, error)
+	deleteDigestItemsMock     func(ids []int64) error
+	addBookmarkMock           func() (bool, error)
+	addChannelMock            func() error
+	getChannelsMock           func() ([]database.Channel, error)
+	getChannelMock            func() (*database.Channel, error)
+	getBookmarksMock          func() ([]database.Bookmark, int, error)
+	deleteBookmarkMock        func() (*database.Bookmark, error)
 	getUserFeedsMock          func() ([]database.Feed, error)
 	getUserURIFeedMock        func() (*database.Feed, error)
 	getUserNormalizedFeedMock func() (*database.Feed, error)
+	getUserIDFeedMock         func() (*database.Feed, error)
 	getFeedMock               func() (*database.Feed, error)
 	getFeedsMock              func() ([]database.Feed, error)
 	resetFeedMock             func() error
 	getFeedUsersMock          func() ([]database.UserFeed, error)
-	getAllUsersMock           func() ([]int64, error)
+	getAllUsersMock           func() ([]database.User, error)
+	addFeedItemsMock          func() error
+	getNewFeedItemsMock       func() ([]string, error)
+	hasFeedItemsMock          func() (bool, error)
+	getFeedItemMock           func() (*database.FeedItem, error)
+	getFeedItemsMock          func() ([]database.FeedItem, error)
+	getUserURIFeedItemMock    func() (*database.FeedItem, error)
+	deleteFeedItemsMock       func() error
+	addOutboxMock             func() error
+	getOutboxMock             func(skip []int64) ([]database.OutboxMessage, error)
+	setOutboxSentMock         func() error
+	setOutboxRetryMock        func() error
+	setOutboxFailedMock       func() error
+	deleteOutboxMock          func() error
+	countOutboxMock           func() (int, error)
+	pingMock                  func() error
 	setFeedUpdatedMock        func() error
 	setFeedLastPubMock        func() error
+	setFeedScheduleMock       func() error
+	setFeedCacheMock          func() error
 	setFeedBrokenMock         func() error
+	disableFeedMock           func() error
 }
 
 func (db *dbMock) Close()                             {}
+func (db *dbMock) Ping() error                        { return db.pingMock() }
 func (db *dbMock) GetStats() (*database.Stats, error) { return db.getStatsMock() }
-func (db *dbMock) AddFeed(name string, normalized string, uri string) (*database.Feed, error) {
+func (db *dbMock) AddFeed(name string, normalized string, uri string, link string) (*database.Feed, error) {
 	return db.addFeedMock()
 }
-func (db *dbMock) Subscribe(userID int64, feedID int) error           { return db.subscribeMock() }
+func (db *dbMock) Subscribe(userID int64, feedID int, category string) error { return db.subscribeMock() }
+func (db *dbMock) SetFilters(userID int64, feedID int, filters []string) error {
+	return db.setFiltersMock()
+}
+func (db *dbMock) Pause(userID int64, feedID int, until *time.Time) error { return db.pauseMock() }
+func (db *dbMock) Mute(userID int64, feedID int, until time.Time) error   { return db.muteMock() }
+func (db *dbMock) Resume(userID int64, feedID int) error              { return db.resumeMock() }
 func (db *dbMock) Unsubscribe(userID int64, feedID int) error         { return db.unsubscribeMock() }
 func (db *dbMock) DeleteUser(userID int64) error                      { return db.deleteUserMock() }
+func (db *dbMock) GetUser(userID int64) (*database.User, error) { return db.getUserMock() }
+func (db *dbMock) SetUserLang(userID int64, lang string) error { return db.setUserLangMock() }
+func (db *dbMock) SetUserTimezone(userID int64, timezone string) error { return db.setUserTimezoneMock() }
+func (db *dbMock) SetUserQuiet(userID int64, quiet database.Quiet) error { return db.setUserQuietMock() }
+func (db *dbMock) SetUserDigest(userID int64, digest string, digestAt int) error {
+	return db.setUserDigestMock()
+}
+func (db *dbMock) SetUserDigested(userID int64, at time.Time) error     { return db.setUserDigestedMock() }
+func (db *dbMock) AddDigestItem(item database.DigestItem) error         { return db.addDigestItemMock() }
+func (db *dbMock) GetDigestUsers() ([]database.User, error)             { return db.getDigestUsersMock() }
+func (db *dbMock) GetDigestItems(userID int64) ([]database.DigestItem, error) {
+	return db.getDigestItemsMock()
+}
+func (db *dbMock) DeleteDigestItems(userID int64, ids []int64) error { return db.deleteDigestItemsMock(ids) }
+func (db *dbMock) AddBookmark(userID int64, item database.FeedItem) (bool, error) { return db.addBookmarkMock() }
+func (db *dbMock) AddChannel(channel database.Channel) error          { return db.addChannelMock() }
+func (db *dbMock) GetChannels(ownerID int64) ([]database.Channel, error) { return db.getChannelsMock() }
+func (db *dbMock) GetChannel(ownerID int64, name string) (*database.Channel, error) { return db.getChannelMock() }
+func (db *dbMock) GetBookmarks(userID int64, offset int, count int) ([]database.Bookmark, int, error) { return db.getBookmarksMock() }
+func (db *dbMock) DeleteBookmark(userID int64, position int) (*database.Bookmark, error) { return db.deleteBookmarkMock() }
 func (db *dbMock) GetUserFeeds(userID int64) ([]database.Feed, error) { return db.getUserFeedsMock() }
 func (db *dbMock) GetUserURIFeed(userID int64, uri string) (*database.Feed, error) {
 	return db.getUserURIFeedMock()
@@ -441,11 +1393,35 @@ func (db *dbMock) GetUserURIFeed(userID int64, uri string) (*database.Feed, erro
 func (db *dbMock) GetUserNormalizedFeed(userID int64, normalized string) (*database.Feed, error) {
 	return db.getUserNormalizedFeedMock()
 }
+func (db *dbMock) GetUserIDFeed(userID int64, feedID int) (*database.Feed, error) {
+	return db.getUserIDFeedMock()
+}
 func (db *dbMock) GetFeed(uri string) (*database.Feed, error)           { return db.getFeedMock() }
 func (db *dbMock) GetFeeds(count int) ([]database.Feed, error)          { return db.getFeedsMock() }
 func (db *dbMock) GetFeedUsers(feedID int) ([]database.UserFeed, error) { return db.getFeedUsersMock() }
-func (db *dbMock) GetAllUsers() ([]int64, error)                        { return db.getAllUsersMock() }
+func (db *dbMock) GetAllUsers() ([]database.User, error)                { return db.getAllUsersMock() }
 func (db *dbMock) ResetFeed(feedID int) error                           { return db.resetFeedMock() }
+func (db *dbMock) AddFeedItems(feedID int, items []database.FeedItem) error { return db.addFeedItemsMock() }
+func (db *dbMock) GetNewFeedItems(feedID int, guids []string) ([]string, error) { return db.getNewFeedItemsMock() }
+func (db *dbMock) HasFeedItems(feedID int) (bool, error)                       { return db.hasFeedItemsMock() }
+func (db *dbMock) GetFeedItem(feedID int, key string) (*database.FeedItem, error) { return db.getFeedItemMock() }
+func (db *dbMock) GetFeedItems(feedID int, count int) ([]database.FeedItem, error) { return db.getFeedItemsMock() }
+func (db *dbMock) GetUserURIFeedItem(userID int64, uri string) (*database.FeedItem, error) { return db.getUserURIFeedItemMock() }
+func (db *dbMock) DeleteFeedItems(before time.Time) error               { return db.deleteFeedItemsMock() }
+func (db *dbMock) AddOutbox(chatID int64, text string, markup string, silent bool) error { return db.addOutboxMock() }
+func (db *dbMock) GetOutbox(count int, skip []int64) ([]database.OutboxMessage, error) {
+	return db.getOutboxMock(skip)
+}
+func (db *dbMock) SetOutboxSent(id int64) error                          { return db.setOutboxSentMock() }
+func (db *dbMock) SetOutboxRetry(id int64, lastError string, retry time.Duration) error {
+	return db.setOutboxRetryMock()
+}
+func (db *dbMock) SetOutboxFailed(id int64, lastError string) error { return db.setOutboxFailedMock() }
+func (db *dbMock) DeleteOutbox(before time.Time) error              { return db.deleteOutboxMock() }
+func (db *dbMock) CountOutbox() (int, error)                          { return db.countOutboxMock() }
 func (db *dbMock) SetFeedUpdated(id int) error                          { return db.setFeedUpdatedMock() }
 func (db *dbMock) SetFeedLastPub(id int, lastPub time.Time, lastPubURI string) error { return db.setFeedLastPubMock() }
-func (db *dbMock) SetFeedBroken(id int) error                           { return db.setFeedBrokenMock() }
+func (db *dbMock) SetFeedSchedule(id int, interval time.Duration) error { return db.setFeedScheduleMock() }
+func (db *dbMock) SetFeedCache(id int, etag string, lastModified string) error { return db.setFeedCacheMock() }
+func (db *dbMock) SetFeedBroken(id int, lastError string, retry time.Duration) error { return db.setFeedBrokenMock() }
+func (db *dbMock) DisableFeed(id int, lastError string, retry time.Duration) error { return db.disableFeedMock() }
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"time"
+	"unicode/utf16"
+
+	log "github.com/go-pkgz/lgr"
+
+	"github.com/vladikan/addrss-telegram/database"
+	"github.com/vladikan/addrss-telegram/parser"
+	"github.com/vladikan/addrss-telegram/templates"
+)
+
+// Digest delivery modes
+const (
+	digestInstant = "instant"
+	digestHourly  = "hourly"
+	digestDaily   = "daily"
+)
+
+const (
+	digestPoll    = time.Minute
+	maxMessageLen = 4096
+)
+
+// Digester sends queued articles to the users in digest mode
+type Digester struct {
+	DB     database.Database
+	Outbox chan Reply
+
+	stop chan interface{}
+	done chan interface{}
+}
+
+// Start will look for due digests
+func (dg *Digester) Start() {
+	dg.stop = make(chan interface{})
+	dg.done = make(chan interface{})
+	tick := time.NewTicker(digestPoll)
+
+	go func() {
+		defer close(dg.done)
+		for {
+			select {
+			case <-dg.stop:
+				tick.Stop()
+				return
+			case <-tick.C:
+				if err := dg.sendDigests(time.Now()); err != nil {
+					log.Printf("ERROR digester fault: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops all digester activities and waits till the current job is completed
+func (dg *Digester) Stop() {
+	close(dg.stop)
+	<-dg.done
+	log.Print("INFO Digester jobs terminated")
+}
+
+func (dg *Digester) sendDigests(now time.Time) error {
+	users, err := dg.DB.GetDigestUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, usr := range users {
+		quiet := inQuietHours(usr.Quiet, usr.Timezone, now)
+		if (quiet && usr.Quiet.Mode == quietHold) || !digestDue(usr, now) {
+			continue
+		}
+
+		items, err := dg.DB.GetDigestItems(usr.ID)
+		if err != nil {
+			log.Printf("ERROR User %d unable get digest items: %s", usr.ID, err)
+			continue
+		}
+
+		if len(items) == 0 {
+			continue
+		}
+
+		for _, txt := range buildDigest(usr.Lang, items) {
+			dg.Outbox <- Reply{ChatID: usr.ID, Text: txt, Silent: quiet}
+		}
+		itemsDelivered.WithLabelValues("digest").Add(float64(len(items)))
+
+		// Items are ordered by feed, so exactly the sent ones are deleted
+		ids := make([]int64, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+
+		if err = dg.DB.DeleteDigestItems(usr.ID, ids); err != nil {
+			log.Printf("ERROR User %d unable delete digest items: %s", usr.ID, err)
+		}
+
+		if err = dg.DB.SetUserDigested(usr.ID, now); err != nil {
+			log.Printf("ERROR User %d unable update digest date: %s", usr.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// digestDue checks if user digest should be sent, items left from other modes or held during quiet hours are sent at once
+func digestDue(usr database.User, now time.Time) bool {
+	if usr.LastDigest == nil {
+		return true
+	}
+
+	switch usr.Digest {
+	case digestHourly:
+		return usr.LastDigest.Before(now.Truncate(time.Hour))
+	case digestDaily:
+		now = now.In(userLocation(usr.Timezone))
+		at := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(time.Duration(usr.DigestAt) * time.Minute)
+		if now.Before(at) {
+			at = at.AddDate(0, 0, -1)
+		}
+
+		return usr.LastDigest.Before(at)
+	}
+
+	return true
+}
+
+// buildDigest renders one or more messages per feed, each message fits Telegram length limit
+func buildDigest(lang string, items []database.DigestItem) []string {
+	type digest struct {
+		Feed   string
+		Topics []parser.Topic
+	}
+
+	var rst []string
+	var current *digest
+	var last string
+
+	flush := func() {
+		if current != nil && len(current.Topics) > 0 {
+			rst = append(rst, last)
+		}
+	}
+
+	for _, item := range items {
+		topic := parser.Topic{Feed: item.Feed, Title: item.Title, URI: item.URI, Date: item.Date}
+		if current == nil || current.Feed != item.Feed {
+			flush()
+			current = &digest{Feed: item.Feed}
+		}
+
+		current.Topics = append(current.Topics, topic)
+		txt, _ := templates.ToTextW(lang, "digest", current)
+		if messageLen(txt) > maxMessageLen && len(current.Topics) > 1 {
+			current.Topics = current.Topics[:len(current.Topics)-1]
+			flush()
+
+			current = &digest{Feed: item.Feed, Topics: []parser.Topic{topic}}
+			txt, _ = templates.ToTextW(lang, "digest", current)
+		}
+
+		last = txt
+	}
+
+	flush()
+	return rst
+}
+
+// messageLen counts length the same way as Telegram in UTF-16 code units
+func messageLen(txt string) int {
+	return len(utf16.Encode([]rune(txt)))
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vladikan/addrss-telegram/database"
+	"github.com/vladikan/addrss-telegram/templates"
+)
+
+func TestDigestDue_Hourly(t *testing.T) {
+	now := time.Date(2020, 7, 4, 15, 10, 0, 0, time.UTC)
+	sent := now.Add(-5 * time.Minute)
+	if digestDue(database.User{Digest: digestHourly, LastDigest: &sent}, now) {
+		t.Errorf("Expected hourly digest to wait for the next hour")
+	}
+
+	if !digestDue(database.User{Digest: digestHourly, LastDigest: &sent}, now.Add(time.Hour)) {
+		t.Errorf("Expected hourly digest to be due")
+	}
+}
+
+func TestDigestDue_Daily(t *testing.T) {
+	now := time.Date(2020, 7, 4, 15, 10, 0, 0, time.UTC)
+	sent := time.Date(2020, 7, 4, 9, 0, 0, 0, time.UTC)
+	usr := database.User{Digest: digestDaily, DigestAt: 9 * 60, LastDigest: &sent}
+
+	if digestDue(usr, now) {
+		t.Errorf("Expected daily digest to be already sent today")
+	}
+
+	if !digestDue(usr, now.Add(18*time.Hour)) {
+		t.Errorf("Expected daily digest to be due next day")
+	}
+}
+
+func TestDigestDue_DailyUserTimezone(t *testing.T) {
+	sent := time.Date(2020, 7, 3, 7, 0, 0, 0, time.UTC)
+	usr := database.User{Digest: digestDaily, DigestAt: 9 * 60, LastDigest: &sent, Timezone: "Europe/Berlin"}
+
+	if digestDue(usr, time.Date(2020, 7, 4, 6, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected daily digest to wait for 09:00 in user timezone")
+	}
+
+	if !digestDue(usr, time.Date(2020, 7, 4, 7, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected daily digest to be due at 09:00 in user timezone")
+	}
+}
+
+func TestSendDigests_QuietHours(t *testing.T) {
+	now := time.Date(2020, 7, 4, 2, 0, 0, 0, time.UTC)
+	users := []database.User{
+		{ID: 1, Quiet: database.Quiet{Mode: quietHold, From: 23 * 60, To: 8 * 60}},
+		{ID: 2, Quiet: database.Quiet{Mode: quietSilent, From: 23 * 60, To: 8 * 60}},
+	}
+
+	dg := &Digester{Outbox: make(chan Reply, 10), DB: &dbMock{
+		getDigestUsersMock:    func() ([]database.User, error) { return users, nil },
+		getDigestItemsMock:    func() ([]database.DigestItem, error) { return []database.DigestItem{{ID: 1, Feed: "a"}}, nil },
+		deleteDigestItemsMock: func([]int64) error { return nil },
+		setUserDigestedMock:   func() error { return nil },
+	}}
+
+	if err := dg.sendDigests(now); err != nil {
+		t.Errorf("Error was not expected, but was '%s'", err)
+	}
+	close(dg.Outbox)
+
+	var replies []Reply
+	for reply := range dg.Outbox {
+		replies = append(replies, reply)
+	}
+
+	if len(replies) != 1 || replies[0].ChatID != 2 || !replies[0].Silent {
+		t.Errorf("Expected single silent digest for user 2, but was %+v", replies)
+	}
+}
+
+func TestSendDigests_DeletesSentItems(t *testing.T) {
+	now := time.Date(2020, 7, 4, 15, 10, 0, 0, time.UTC)
+	items := []database.DigestItem{{ID: 1, Feed: "a"}, {ID: 4, Feed: "a"}, {ID: 2, Feed: "b"}, {ID: 3, Feed: "b"}}
+
+	var deleted []int64
+	dg := &Digester{Outbox: make(chan Reply, 10), DB: &dbMock{
+		getDigestUsersMock: func() ([]database.User, error) { return []database.User{{ID: 1}}, nil },
+		getDigestItemsMock: func() ([]database.DigestItem, error) { return items, nil },
+		deleteDigestItemsMock: func(ids []int64) error {
+			deleted = ids
+			return nil
+		},
+		setUserDigestedMock: func() error { return nil },
+	}}
+
+	if err := dg.sendDigests(now); err != nil {
+		t.Errorf("Error was not expected, but was '%s'", err)
+	}
+
+	if !reflect.DeepEqual(deleted, []int64{1, 4, 2, 3}) {
+		t.Errorf("Expected sent items to be deleted, but was %v", deleted)
+	}
+}
+
+func TestBuildDigest_GroupsByFeed(t *testing.T) {
+	items := []database.DigestItem{{ID: 1, Feed: "a"}, {ID: 2, Feed: "a"}, {ID: 3, Feed: "b"}}
+	rst := buildDigest("en", items)
+	if len(rst) != 2 {
+		t.Errorf("Expected 2 messages, but was %d", len(rst))
+	}
+}
+
+func TestBuildDigest_EscapesText(t *testing.T) {
+	defer setup()
+	if err := templates.SetTemplateOutput(""); err != nil {
+		t.Fatalf("Error not expected, but was: %s", err)
+	}
+
+	items := []database.DigestItem{{ID: 1, Feed: "News & Co", Title: "a < b", URI: "https://example.com/?a=1&b=2"}}
+	rst := buildDigest("en", items)
+	if len(rst) != 1 {
+		t.Fatalf("Expected 1 message, but was %d", len(rst))
+	}
+
+	for _, exp := range []string{"News &amp; Co", "a &lt; b", "?a=1&amp;b=2"} {
+		if !strings.Contains(rst[0], exp) {
+			t.Errorf("Expected '%s' in '%s'", exp, rst[0])
+		}
+	}
+}
+
+func TestBuildDigest_SplitsLongMessages(t *testing.T) {
+	defer setup()
+	templates.SetCustomOutput(func(lang string, name string, data interface{}) (string, error) {
+		topics := reflect.ValueOf(data).Elem().FieldByName("Topics").Len()
+		return strings.Repeat("x", topics*1000), nil
+	})
+
+	var items []database.DigestItem
+	for i := 0; i < 10; i++ {
+		items = append(items, database.DigestItem{ID: int64(i), Feed: "a"})
+	}
+
+	rst := buildDigest("en", items)
+	if len(rst) != 3 {
+		t.Errorf("Expected 3 messages, but was %d", len(rst))
+	}
+
+	for _, txt := range rst {
+		if messageLen(txt) > maxMessageLen {
+			t.Errorf("Expected message to fit the limit, but was %d", messageLen(txt))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"container/list"
+	"crypto/md5"
+	"encoding/hex"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/vladikan/addrss-telegram/parser"
+)
+
+// Feed urls do not fit into 64 bytes of the button data, buttons carry short keys of the discovered urls
+const (
+	sourceKeyLength = 12
+	maxSources      = 1024
+)
+
+var sources = newSourceCache(maxSources)
+
+// sourceCache keeps discovered feed urls till the user picks one, least recently used urls are evicted when it grows too big
+type sourceCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	urls  map[string]*list.Element
+}
+
+type sourceEntry struct {
+	key string
+	uri string
+}
+
+func newSourceCache(size int) *sourceCache {
+	return &sourceCache{size: size, order: list.New(), urls: make(map[string]*list.Element)}
+}
+
+func (c *sourceCache) put(uri string) string {
+	hash := md5.Sum([]byte(uri))
+	key := hex.EncodeToString(hash[:])[:sourceKeyLength]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.urls[key]; ok {
+		el.Value = sourceEntry{key: key, uri: uri}
+		c.order.MoveToFront(el)
+		return key
+	}
+
+	c.urls[key] = c.order.PushFront(sourceEntry{key: key, uri: uri})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.urls, oldest.Value.(sourceEntry).key)
+	}
+
+	return key
+}
+
+func (c *sourceCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.urls[key]
+	if !ok {
+		return "", false
+	}
+
+	c.order.MoveToFront(el)
+	return el.Value.(sourceEntry).uri, true
+}
+
+// sourcesMarkup builds inline keyboard with a button to subscribe each discovered feed
+func sourcesMarkup(chatID int64, found []parser.Source) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, src := range found {
+		text := src.Title
+		if len(text) == 0 {
+			text = src.URL
+		}
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(newButton(chatID, text, "add", sources.put(src.URL))))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSourceCache_EvictsOldest(t *testing.T) {
+	cache := newSourceCache(2)
+	first := cache.put("https://example.com/1")
+	second := cache.put("https://example.com/2")
+
+	// Reading the first url keeps it over the second one
+	if _, ok := cache.get(first); !ok {
+		t.Fatalf("Expected first url to be cached")
+	}
+	third := cache.put("https://example.com/3")
+
+	if _, ok := cache.get(second); ok {
+		t.Errorf("Expected least recently used url to be evicted")
+	}
+
+	for i, key := range []string{first, third} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("[%d] Expected url to stay cached", i)
+		}
+	}
+}
+
+func TestSourceCache_KeepsSize(t *testing.T) {
+	cache := newSourceCache(10)
+	for i := 0; i < 100; i++ {
+		cache.put(fmt.Sprintf("https://example.com/%d", i))
+	}
+
+	if cache.order.Len() != 10 || len(cache.urls) != 10 {
+		t.Errorf("Expected 10 cached urls, but was %d", len(cache.urls))
+	}
+
+	if uri, ok := cache.get(cache.put("https://example.com/99")); !ok || uri != "https://example.com/99" {
+		t.Errorf("Expected the latest url to stay cached, but was '%s'", uri)
+	}
+}
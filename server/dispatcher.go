@@ -0,0 +1,259 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"github.com/vladikan/addrss-telegram/database"
+)
+
+const (
+	outboxBatch       = 100
+	outboxAttempts    = 10
+	outboxPoll        = time.Second
+	outboxRetention   = 7 * 24 * time.Hour
+	outboxMinRetry    = 5 * time.Second
+	outboxMaxRetry    = time.Hour
+	outboxCleanPeriod = time.Hour
+	outboxFlushTime   = 10 * time.Second
+	outboxFlushPause  = 100 * time.Millisecond
+)
+
+// Dispatcher persists replies to the outbox and delivers them with retries within Telegram rate limits
+type Dispatcher struct {
+	DB database.Database
+
+	stop    chan interface{}
+	done    chan interface{}
+	notify  chan interface{}
+	limiter *sendLimiter
+}
+
+// Start will deliver pending outbox messages
+func (ds *Dispatcher) Start() {
+	ds.stop = make(chan interface{})
+	ds.done = make(chan interface{})
+	ds.notify = make(chan interface{}, 1)
+	ds.limiter = newSendLimiter()
+
+	go func() {
+		defer close(ds.done)
+		tick := time.NewTicker(outboxPoll)
+		defer tick.Stop()
+
+		var cleaned time.Time
+		for {
+			if time.Since(cleaned) > outboxCleanPeriod {
+				if err := ds.DB.DeleteOutbox(time.Now().Add(-outboxRetention)); err != nil {
+					log.Printf("ERROR Unable to delete completed outbox messages: %s", err)
+				}
+				cleaned = time.Now()
+			}
+
+			ds.deliver(ds.stop)
+
+			select {
+			case <-ds.stop:
+				ds.flush(time.Now().Add(outboxFlushTime))
+				return
+			case <-tick.C:
+			case <-ds.notify:
+			}
+		}
+	}()
+}
+
+// Stop delivers due messages within a deadline and stops outbox delivery
+func (ds *Dispatcher) Stop() {
+	close(ds.stop)
+	<-ds.done
+	log.Print("INFO Dispatcher jobs terminated")
+}
+
+// Push persists reply and wakes up delivery
+func (ds *Dispatcher) Push(msg Reply) {
+	var markup string
+	if msg.Markup != nil {
+		raw, _ := json.Marshal(msg.Markup)
+		markup = string(raw)
+	}
+
+	if err := ds.DB.AddOutbox(msg.ChatID, msg.Text, markup, msg.Silent); err != nil {
+		log.Printf("ERROR Unable to persist reply to %d chat, sending directly: %s", msg.ChatID, err)
+		if err = sendReply(msg); err != nil {
+			log.Printf("ERROR %T Problem while replying on %d chat: %s", err, msg.ChatID, err)
+		}
+		return
+	}
+
+	select {
+	case ds.notify <- nil:
+	default:
+	}
+}
+
+// flush delivers due messages till there are no more of them or deadline is reached
+func (ds *Dispatcher) flush(deadline time.Time) {
+	expired := make(chan interface{})
+	timer := time.AfterFunc(time.Until(deadline), func() { close(expired) })
+	defer timer.Stop()
+
+	for {
+		if ds.deliver(expired) == 0 {
+			return
+		}
+
+		// Give chat limits time to refill
+		if !sleep(outboxFlushPause, expired) {
+			break
+		}
+	}
+
+	log.Print("WARN Dispatcher flush deadline reached, undelivered messages are left in outbox")
+}
+
+// sleep waits for duration and returns false when it is interrupted by abort
+func sleep(d time.Duration, abort <-chan interface{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-abort:
+		return false
+	}
+}
+
+// deliver sends due messages within limits and returns number of due messages found, waits for limits are interrupted by abort
+func (ds *Dispatcher) deliver(abort <-chan interface{}) int {
+	ds.limiter.cleanup(time.Now())
+
+	// Chats out of limits are skipped till the next round to keep their messages order,
+	// they are left out of the next reads, so their backlog can't hide other chats
+	due := 0
+	skipped := make(map[int64]bool)
+	var skip []int64
+	for {
+		msgs, err := ds.DB.GetOutbox(outboxBatch, skip)
+		if err != nil {
+			log.Printf("ERROR Unable to read outbox: %s", err)
+			return due
+		}
+		due += len(msgs)
+
+		for _, msg := range msgs {
+			if skipped[msg.ChatID] {
+				continue
+			}
+
+			chat := ds.limiter.chat(msg.ChatID, time.Now())
+			if chat.wait(time.Now()) > 0 {
+				skipped[msg.ChatID] = true
+				skip = append(skip, msg.ChatID)
+				continue
+			}
+
+			if wait := ds.limiter.global.wait(time.Now()); wait > 0 && !sleep(wait, abort) {
+				return due
+			}
+
+			now := time.Now()
+			chat.take(now)
+			ds.limiter.global.take(now)
+
+			if retry := ds.send(msg); retry > 0 {
+				chat.delay(retry, time.Now())
+				skipped[msg.ChatID] = true
+				skip = append(skip, msg.ChatID)
+			}
+		}
+
+		// Every read either sends messages or skips more chats
+		if len(msgs) < outboxBatch {
+			return due
+		}
+	}
+}
+
+// send delivers single message and returns delay before the next attempt if it failed
+func (ds *Dispatcher) send(msg database.OutboxMessage) time.Duration {
+	reply := Reply{ChatID: msg.ChatID, Text: msg.Text, Silent: msg.Silent}
+	if len(msg.Markup) > 0 {
+		reply.Markup = &tgbotapi.InlineKeyboardMarkup{}
+		if err := json.Unmarshal([]byte(msg.Markup), reply.Markup); err != nil {
+			log.Printf("ERROR Outbox message %d has broken markup: %s", msg.ID, err)
+			reply.Markup = nil
+		}
+	}
+
+	err := sendReply(reply)
+	if err == nil {
+		if err = ds.DB.SetOutboxSent(msg.ID); err != nil {
+			log.Printf("ERROR Unable to mark outbox message %d as sent: %s", msg.ID, err)
+		}
+		return 0
+	}
+
+	retry, blocked := classifySendError(err, msg.Attempts+1)
+	if blocked {
+		usersBlocked.Inc()
+		ds.DB.DeleteUser(msg.ChatID)
+		log.Printf("WARN user %d is blocked the bot and now deleted", msg.ChatID)
+	}
+
+	if retry <= 0 {
+		log.Printf("ERROR %T Problem while replying on %d chat: %s", err, msg.ChatID, err)
+		sendErrors.WithLabelValues("failed").Inc()
+		err = ds.DB.SetOutboxFailed(msg.ID, err.Error())
+	} else {
+		log.Printf("WARN Reply to %d chat will be retried in %s: %s", msg.ChatID, retry, err)
+		sendErrors.WithLabelValues("retry").Inc()
+		err = ds.DB.SetOutboxRetry(msg.ID, err.Error(), retry)
+	}
+
+	if err != nil {
+		log.Printf("ERROR Unable to update outbox message %d: %s", msg.ID, err)
+	}
+
+	return retry
+}
+
+// classifySendError returns delay before next attempt, zero for permanent errors.
+// Flag is set when user has blocked the bot.
+func classifySendError(err error, attempts int) (time.Duration, bool) {
+	txt := strings.ToLower(err.Error())
+	if strings.Contains(txt, "forbidden") {
+		return 0, true
+	}
+
+	if attempts >= outboxAttempts {
+		return 0, false
+	}
+
+	if tgErr, ok := err.(tgbotapi.Error); ok {
+		if tgErr.RetryAfter > 0 {
+			return time.Duration(tgErr.RetryAfter) * time.Second, false
+		}
+
+		if strings.Contains(txt, "bad request") || strings.Contains(txt, "not found") {
+			return 0, false
+		}
+	}
+
+	// Network and server side errors are transient
+	retry := outboxMinRetry
+	for i := 1; i < attempts && retry < outboxMaxRetry; i++ {
+		retry *= 2
+	}
+
+	if retry > outboxMaxRetry {
+		retry = outboxMaxRetry
+	}
+
+	return retry, false
+}
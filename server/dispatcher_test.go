@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"github.com/vladikan/addrss-telegram/database"
+)
+
+func TestClassifySendError_Blocked(t *testing.T) {
+	retry, blocked := classifySendError(tgbotapi.Error{Message: "Forbidden: bot was blocked by the user"}, 1)
+	if retry != 0 || !blocked {
+		t.Errorf("Expected permanent blocked error, but was %s and %t", retry, blocked)
+	}
+}
+
+func TestClassifySendError_RetryAfter(t *testing.T) {
+	err := tgbotapi.Error{Message: "Too Many Requests: retry after 7", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}}
+	retry, blocked := classifySendError(err, 1)
+	if retry != 7*time.Second || blocked {
+		t.Errorf("Expected 7s retry, but was %s and %t", retry, blocked)
+	}
+}
+
+func TestClassifySendError_BadRequest(t *testing.T) {
+	retry, _ := classifySendError(tgbotapi.Error{Message: "Bad Request: message is too long"}, 1)
+	if retry != 0 {
+		t.Errorf("Expected permanent error, but was %s", retry)
+	}
+}
+
+func TestClassifySendError_Transient(t *testing.T) {
+	err := errors.New("connection reset by peer")
+	if retry, _ := classifySendError(err, 1); retry != outboxMinRetry {
+		t.Errorf("Expected %s retry, but was %s", outboxMinRetry, retry)
+	}
+
+	if retry, _ := classifySendError(err, 3); retry != 4*outboxMinRetry {
+		t.Errorf("Expected %s retry, but was %s", 4*outboxMinRetry, retry)
+	}
+
+	if retry, _ := classifySendError(err, outboxAttempts); retry != 0 {
+		t.Errorf("Expected no retry after max attempts, but was %s", retry)
+	}
+}
+
+func TestDispatcher_StopFlushesOutbox(t *testing.T) {
+	reads := 0
+	ds := &Dispatcher{DB: &dbMock{
+		deleteOutboxMock: func() error { return nil },
+		getOutboxMock: func([]int64) ([]database.OutboxMessage, error) {
+			reads++
+			return nil, nil
+		},
+	}}
+
+	ds.Start()
+	ds.Stop()
+
+	// Regular delivery on start and one more on flush
+	if reads != 2 {
+		t.Errorf("Expected 2 outbox reads, but was %d", reads)
+	}
+}
+
+func TestHandleReply_DrainsQueue(t *testing.T) {
+	persisted := 0
+	ds := &Dispatcher{
+		DB:     &dbMock{addOutboxMock: func() error { persisted++; return nil }},
+		notify: make(chan interface{}, 1),
+	}
+
+	queue := make(chan Reply, 3)
+	done := make(chan interface{})
+	for i := 0; i < 3; i++ {
+		queue <- Reply{ChatID: int64(i)}
+	}
+	close(queue)
+
+	handleReply(queue, ds, done)
+	<-done
+
+	if persisted != 3 {
+		t.Errorf("Expected 3 persisted replies, but was %d", persisted)
+	}
+}
+
+func TestDispatcher_GlobalWaitIsInterrupted(t *testing.T) {
+	ds := &Dispatcher{limiter: newSendLimiter(), DB: &dbMock{
+		getOutboxMock: func([]int64) ([]database.OutboxMessage, error) {
+			return []database.OutboxMessage{{ID: 1, ChatID: 1}}, nil
+		},
+	}}
+
+	// Global limit is exhausted for minutes
+	ds.limiter.global = &tokenBucket{rate: 0.01, burst: 1, last: time.Now()}
+
+	abort := make(chan interface{})
+	done := make(chan int)
+	go func() { done <- ds.deliver(abort) }()
+
+	close(abort)
+	select {
+	case due := <-done:
+		if due != 1 {
+			t.Errorf("Expected 1 due message, but was %d", due)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected delivery to stop waiting for the limit on abort")
+	}
+}
+
+func TestDispatcher_LimitedChatsDoNotHideOthers(t *testing.T) {
+	var outbox []database.OutboxMessage
+	for i := 0; i <= outboxBatch; i++ {
+		outbox = append(outbox, database.OutboxMessage{ID: int64(i), ChatID: 1})
+	}
+	outbox = append(outbox, database.OutboxMessage{ID: int64(len(outbox)), ChatID: 2})
+
+	reached := false
+	ds := &Dispatcher{limiter: newSendLimiter(), DB: &dbMock{
+		getOutboxMock: func(skip []int64) ([]database.OutboxMessage, error) {
+			var msgs []database.OutboxMessage
+			for _, msg := range outbox {
+				if len(msgs) < outboxBatch && !slices.Contains(skip, msg.ChatID) {
+					msgs = append(msgs, msg)
+					reached = reached || msg.ChatID == 2
+				}
+			}
+			return msgs, nil
+		},
+	}}
+
+	// Both chats are out of limits, so nothing is sent
+	now := time.Now()
+	ds.limiter.chats[1] = &tokenBucket{rate: chatRate, burst: chatBurst, last: now}
+	ds.limiter.chats[2] = &tokenBucket{rate: chatRate, burst: chatBurst, last: now}
+
+	ds.deliver(make(chan interface{}))
+	if !reached {
+		t.Errorf("Expected chat behind the limited backlog to be read")
+	}
+}
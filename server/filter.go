@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/vladikan/addrss-telegram/parser"
+)
+
+// filter holds compiled include and exclude rules of the subscription
+type filter struct {
+	include []func(string) bool
+	exclude []func(string) bool
+}
+
+// splitRules parses "+keyword -keyword /regex/ -/regex/" input into canonical rules list.
+// Rules without sign are include rules.
+func splitRules(in string) ([]string, error) {
+	var rst []string
+
+	in = strings.TrimSpace(in)
+	for len(in) > 0 {
+		sign := "+"
+		if in[0] == '+' || in[0] == '-' {
+			sign, in = in[:1], in[1:]
+		}
+
+		var body string
+		if strings.HasPrefix(in, "/") {
+			// Regex ends with slash followed by space or end of input
+			end := -1
+			for i := 1; i < len(in); i++ {
+				if in[i] == '/' && (i == len(in)-1 || unicode.IsSpace(rune(in[i+1]))) {
+					end = i
+					break
+				}
+			}
+
+			if end < 2 {
+				return nil, fmt.Errorf("regex '%s' is not closed", in)
+			}
+
+			body, in = in[:end+1], in[end+1:]
+			if _, err := regexp.Compile(body[1 : len(body)-1]); err != nil {
+				return nil, fmt.Errorf("regex '%s' is invalid, %s", body, err)
+			}
+		} else {
+			end := strings.IndexFunc(in, unicode.IsSpace)
+			if end < 0 {
+				end = len(in)
+			}
+
+			body, in = in[:end], in[end:]
+			if len(body) == 0 {
+				return nil, fmt.Errorf("keyword is empty")
+			}
+		}
+
+		rst = append(rst, sign+body)
+		in = strings.TrimSpace(in)
+	}
+
+	return rst, nil
+}
+
+// newFilter compiles canonical rules, invalid rules are ignored
+func newFilter(rules []string) *filter {
+	flt := &filter{}
+	for _, rule := range rules {
+		if len(rule) < 2 {
+			continue
+		}
+
+		var match func(string) bool
+		body := rule[1:]
+		if len(body) > 2 && strings.HasPrefix(body, "/") && strings.HasSuffix(body, "/") {
+			rg, err := regexp.Compile("(?i)" + body[1:len(body)-1])
+			if err != nil {
+				continue
+			}
+			match = rg.MatchString
+		} else {
+			keyword := strings.ToLower(body)
+			match = func(txt string) bool { return strings.Contains(txt, keyword) }
+		}
+
+		if rule[0] == '-' {
+			flt.exclude = append(flt.exclude, match)
+		} else {
+			flt.include = append(flt.include, match)
+		}
+	}
+
+	return flt
+}
+
+// allow checks topic title and text, topic should match any include rule and no exclude rules
+func (flt *filter) allow(topic parser.Topic) bool {
+	txt := strings.ToLower(topic.Title + "\n" + topic.Text)
+	for _, match := range flt.exclude {
+		if match(txt) {
+			return false
+		}
+	}
+
+	if len(flt.include) == 0 {
+		return true
+	}
+
+	for _, match := range flt.include {
+		if match(txt) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/vladikan/addrss-telegram/parser"
+)
+
+func TestSplitRules(t *testing.T) {
+	rst, err := splitRules(" go +rust  -java /kotlin \\d+/ -/c\\+\\+/ ")
+	if err != nil {
+		t.Errorf("Error was not expected, but was '%s'", err)
+	}
+
+	exp := []string{"+go", "+rust", "-java", "+/kotlin \\d+/", "-/c\\+\\+/"}
+	if len(rst) != len(exp) {
+		t.Fatalf("Expected %v, but was %v", exp, rst)
+	}
+
+	for i := range exp {
+		if rst[i] != exp[i] {
+			t.Errorf("Expected '%s', but was '%s'", exp[i], rst[i])
+		}
+	}
+}
+
+func TestSplitRules_Invalid(t *testing.T) {
+	for _, in := range []string{"/not closed", "/(/", "+ go"} {
+		if _, err := splitRules(in); err == nil {
+			t.Errorf("Expected error for '%s'", in)
+		}
+	}
+}
+
+func TestFilter_Allow(t *testing.T) {
+	flt := newFilter([]string{"+golang", "+/rust \\d+/", "-sponsored"})
+
+	cases := map[string]bool{
+		"GoLang release":           true,
+		"Rust 2 announced":         true,
+		"Sponsored: golang course": false,
+		"Java news":                false,
+	}
+
+	for title, exp := range cases {
+		if rst := flt.allow(parser.Topic{Title: title}); rst != exp {
+			t.Errorf("Expected %t for '%s', but was %t", exp, title, rst)
+		}
+	}
+}
+
+func TestFilter_EmptyAllowsAll(t *testing.T) {
+	if !newFilter(nil).allow(parser.Topic{Title: "any"}) {
+		t.Errorf("Expected empty filter to allow topic")
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"time"
+)
+
+// Telegram limits for outgoing messages
+const (
+	globalRate  = 30.0
+	globalBurst = 30.0
+	chatRate    = 1.0
+	chatBurst   = 1.0
+	groupRate   = 20.0 / 60.0
+	groupBurst  = 1.0
+)
+
+// tokenBucket allows rate events per second with specified burst
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// wait returns duration till the next token is available
+func (tb *tokenBucket) wait(now time.Time) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// take consumes single token, should be called when wait returns zero
+func (tb *tokenBucket) take(now time.Time) {
+	tb.refill(now)
+	tb.tokens--
+}
+
+// delay postpones the next token for the specified duration
+func (tb *tokenBucket) delay(d time.Duration, now time.Time) {
+	tb.refill(now)
+	tb.tokens = 1 - tb.rate*d.Seconds()
+}
+
+// full returns true when bucket has no effect and can be dropped
+func (tb *tokenBucket) full(now time.Time) bool {
+	tb.refill(now)
+	return tb.tokens >= tb.burst
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens += tb.rate * now.Sub(tb.last).Seconds()
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+		tb.last = now
+	}
+}
+
+// sendLimiter holds global and per chat buckets, not safe for concurrent use
+type sendLimiter struct {
+	global *tokenBucket
+	chats  map[int64]*tokenBucket
+}
+
+func newSendLimiter() *sendLimiter {
+	return &sendLimiter{
+		global: newTokenBucket(globalRate, globalBurst, time.Now()),
+		chats:  make(map[int64]*tokenBucket),
+	}
+}
+
+// chat returns chat bucket, groups and channels have negative ids and lower limits
+func (sl *sendLimiter) chat(chatID int64, now time.Time) *tokenBucket {
+	tb, ok := sl.chats[chatID]
+	if !ok {
+		if chatID < 0 {
+			tb = newTokenBucket(groupRate, groupBurst, now)
+		} else {
+			tb = newTokenBucket(chatRate, chatBurst, now)
+		}
+		sl.chats[chatID] = tb
+	}
+
+	return tb
+}
+
+// cleanup drops idle chat buckets
+func (sl *sendLimiter) cleanup(now time.Time) {
+	for chatID, tb := range sl.chats {
+		if tb.full(now) {
+			delete(sl.chats, chatID)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Burst(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(1, 2, now)
+
+	for i := 0; i < 2; i++ {
+		if wait := tb.wait(now); wait != 0 {
+			t.Errorf("Expected token to be available, but wait was %s", wait)
+		}
+		tb.take(now)
+	}
+
+	if wait := tb.wait(now); wait != time.Second {
+		t.Errorf("Expected 1s wait, but was %s", wait)
+	}
+
+	if wait := tb.wait(now.Add(time.Second)); wait != 0 {
+		t.Errorf("Expected token to be refilled, but wait was %s", wait)
+	}
+}
+
+func TestTokenBucket_Delay(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(1, 1, now)
+	tb.delay(5*time.Second, now)
+
+	if wait := tb.wait(now); wait != 5*time.Second {
+		t.Errorf("Expected 5s wait, but was %s", wait)
+	}
+}
+
+func TestSendLimiter_GroupLimits(t *testing.T) {
+	now := time.Now()
+	sl := newSendLimiter()
+
+	group := sl.chat(-100, now)
+	group.take(now)
+	if wait := group.wait(now); wait != 3*time.Second {
+		t.Errorf("Expected 3s wait for group, but was %s", wait)
+	}
+
+	sl.cleanup(now.Add(time.Minute))
+	if len(sl.chats) != 0 {
+		t.Errorf("Expected idle buckets to be dropped, but was %d", len(sl.chats))
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/mmcdole/gofeed"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Bot metrics exposed in Prometheus format
+var (
+	feedsPolled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "addrss_feeds_polled_total", Help: "Number of feed reads",
+	})
+	fetchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "addrss_fetch_errors_total", Help: "Number of failed feed reads by error type",
+	}, []string{"type"})
+	fetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "addrss_fetch_duration_seconds", Help: "Feed fetch latency in seconds", Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+	itemsDelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "addrss_items_delivered_total", Help: "Number of articles delivered to users by mode",
+	}, []string{"mode"})
+	repliesQueued = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "addrss_replies_queued_total", Help: "Number of replies put to the outbox",
+	})
+	sendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "addrss_send_errors_total", Help: "Number of failed message sends by result",
+	}, []string{"result"})
+	usersBlocked = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "addrss_users_blocked_total", Help: "Number of users deleted after they blocked the bot",
+	})
+	commandsRun = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "addrss_commands_total", Help: "Number of processed user commands",
+	}, []string{"command"})
+	readerSuccess = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "addrss_reader_last_success_timestamp_seconds", Help: "Time of the last successful reader run",
+	}, func() float64 { return float64(readerLastSuccess.Load()) })
+	outboxDepth = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "addrss_outbox_depth", Help: "Number of replies waiting for delivery in the outbox",
+	}, func() float64 {
+		count, err := db.CountOutbox()
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(count)
+	})
+
+	// readerLastSuccess is unix time of the last successful reader run, it is also used by readiness check
+	readerLastSuccess atomic.Int64
+
+	registry = newRegistry(feedsPolled, fetchErrors, fetchDuration, itemsDelivered, repliesQueued, sendErrors, usersBlocked, commandsRun, readerSuccess, outboxDepth)
+)
+
+const statusTimeout = 10 * time.Second
+
+// newRegistry registers bot metrics along with Go runtime and process ones
+func newRegistry(cs ...prometheus.Collector) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	reg.MustRegister(cs...)
+	return reg
+}
+
+// fetchErrorType groups feed read errors for the metrics
+func fetchErrorType(err error) string {
+	var httpErr gofeed.HTTPError
+	if errors.As(err, &httpErr) {
+		return fmt.Sprintf("http_%dxx", httpErr.StatusCode/100)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+
+	if errors.Is(err, gofeed.ErrFeedTypeNotDetected) {
+		return "parse"
+	}
+
+	return "other"
+}
+
+// newStatusHandler serves metrics, liveness and readiness checks
+func newStatusHandler(ready func() error) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, err.Error())
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+
+	return mux
+}
+
+// startStatus runs metrics and health checks server, returns function to stop it
+func startStatus(listen string, ready func() error) func() {
+	srv := &http.Server{Addr: listen, Handler: newStatusHandler(ready), ReadTimeout: statusTimeout, WriteTimeout: statusTimeout}
+	go func() {
+		log.Printf("INFO Serving metrics and health checks on %s", listen)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("ERROR Metrics server fault: %s", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("ERROR Metrics server shutdown: %s", err)
+		}
+	}
+}
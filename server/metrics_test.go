@@ -0,0 +1,110 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/vladikan/addrss-telegram/parser"
+)
+
+func TestFetchErrorType(t *testing.T) {
+	cases := map[error]string{
+		gofeed.HTTPError{StatusCode: 404}:                         "http_4xx",
+		fmt.Errorf("wrap: %w", gofeed.HTTPError{StatusCode: 503}): "http_5xx",
+		&net.DNSError{IsTimeout: true}:                            "timeout",
+		&net.DNSError{}:                                           "network",
+		gofeed.ErrFeedTypeNotDetected:                             "parse",
+		errors.New("test"):                                        "other",
+	}
+
+	for err, exp := range cases {
+		if rst := fetchErrorType(err); rst != exp {
+			t.Errorf("Expected '%s' for '%s', but was '%s'", exp, err, rst)
+		}
+	}
+}
+
+func TestFetchErrorType_Updates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("not a feed"))
+	}))
+	defer srv.Close()
+
+	cases := map[string]string{
+		"/missing": "http_4xx",
+		"/page":    "parse",
+	}
+
+	for path, exp := range cases {
+		_, _, err := parser.GetUpdates(srv.URL+path, time.Time{}, parser.Cache{})
+		if rst := fetchErrorType(err); rst != exp {
+			t.Errorf("Expected '%s' for '%s', but was '%s'", exp, err, rst)
+		}
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	cases := []struct {
+		path   string
+		ready  error
+		status int
+	}{
+		{"/healthz", errors.New("test"), http.StatusOK},
+		{"/readyz", nil, http.StatusOK},
+		{"/readyz", errors.New("test"), http.StatusServiceUnavailable},
+	}
+
+	for _, c := range cases {
+		ready := c.ready
+		rsp := httptest.NewRecorder()
+		newStatusHandler(func() error { return ready }).ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, c.path, nil))
+
+		if rsp.Code != c.status {
+			t.Errorf("Expected %d status for '%s', but was %d", c.status, c.path, rsp.Code)
+		}
+	}
+}
+
+func TestStatusHandler_Metrics(t *testing.T) {
+	db = &dbMock{countOutboxMock: func() (int, error) { return 7, nil }}
+	sendErrors.WithLabelValues("retry").Inc()
+
+	rsp := httptest.NewRecorder()
+	newStatusHandler(func() error { return nil }).ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, exp := range []string{"\naddrss_outbox_depth 7\n", "\naddrss_send_errors_total{result=\"retry\"} "} {
+		if !strings.Contains(rsp.Body.String(), exp) {
+			t.Errorf("Expected '%s' in '%s'", exp, rsp.Body.String())
+		}
+	}
+}
+
+func TestReaderReady(t *testing.T) {
+	now := time.Now()
+	rd := &Reader{Interval: 60, started: now.Add(-time.Minute)}
+	readerLastSuccess.Store(0)
+
+	if err := rd.ready(now); err != nil {
+		t.Errorf("Expected ready reader right after start, but was %s", err)
+	}
+
+	if err := rd.ready(now.Add(5 * time.Minute)); err == nil {
+		t.Errorf("Expected not ready reader without successful runs")
+	}
+
+	readerLastSuccess.Store(now.Add(4 * time.Minute).Unix())
+	if err := rd.ready(now.Add(5 * time.Minute)); err != nil {
+		t.Errorf("Expected ready reader after successful run, but was %s", err)
+	}
+}
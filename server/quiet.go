@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vladikan/addrss-telegram/database"
+)
+
+// Quiet hours modes: hold keeps articles till the end of quiet hours, silent sends them without notification
+const (
+	quietHold   = "hold"
+	quietSilent = "silent"
+)
+
+// userLocation returns user timezone, UTC is used when timezone is not set or unknown
+func userLocation(timezone string) *time.Location {
+	if len(timezone) == 0 {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+func inLocation(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	local := t.In(loc)
+	return &local
+}
+
+// inQuietHours checks if time is within user quiet hours, window may span midnight
+func inQuietHours(quiet database.Quiet, timezone string, now time.Time) bool {
+	if len(quiet.Mode) == 0 || quiet.From == quiet.To {
+		return false
+	}
+
+	now = now.In(userLocation(timezone))
+	minute := now.Hour()*60 + now.Minute()
+	if quiet.From < quiet.To {
+		return minute >= quiet.From && minute < quiet.To
+	}
+
+	return minute >= quiet.From || minute < quiet.To
+}
+
+// parseQuiet reads "HH:MM-HH:MM" window into minutes of the day
+func parseQuiet(in string) (int, int, bool) {
+	from, to, ok := strings.Cut(in, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	fromMinute, toMinute := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	return fromMinute, toMinute, fromMinute != toMinute
+}
+
+func formatMinute(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
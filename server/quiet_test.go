@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vladikan/addrss-telegram/database"
+)
+
+func TestInQuietHours(t *testing.T) {
+	night := database.Quiet{Mode: quietHold, From: 23 * 60, To: 8 * 60}
+	day := database.Quiet{Mode: quietSilent, From: 13 * 60, To: 14 * 60}
+
+	cases := []struct {
+		quiet    database.Quiet
+		timezone string
+		at       time.Time
+		exp      bool
+	}{
+		{night, "", time.Date(2020, 7, 4, 23, 30, 0, 0, time.UTC), true},
+		{night, "", time.Date(2020, 7, 4, 3, 0, 0, 0, time.UTC), true},
+		{night, "", time.Date(2020, 7, 4, 8, 0, 0, 0, time.UTC), false},
+		{night, "Europe/Berlin", time.Date(2020, 7, 4, 22, 30, 0, 0, time.UTC), true},
+		{night, "Europe/Berlin", time.Date(2020, 7, 4, 6, 30, 0, 0, time.UTC), false},
+		{day, "", time.Date(2020, 7, 4, 13, 59, 0, 0, time.UTC), true},
+		{day, "", time.Date(2020, 7, 4, 12, 59, 0, 0, time.UTC), false},
+		{database.Quiet{From: 0, To: 24 * 60}, "", time.Date(2020, 7, 4, 12, 0, 0, 0, time.UTC), false},
+	}
+
+	for i, c := range cases {
+		if rst := inQuietHours(c.quiet, c.timezone, c.at); rst != c.exp {
+			t.Errorf("[%d] Expected '%v' for %s in '%s', but was '%v'", i, c.exp, c.at, c.timezone, rst)
+		}
+	}
+}
+
+func TestParseQuiet(t *testing.T) {
+	from, to, ok := parseQuiet("23:00-08:30")
+	if !ok || from != 23*60 || to != 8*60+30 {
+		t.Errorf("Expected 23:00-08:30 window, but was %d-%d (%v)", from, to, ok)
+	}
+
+	for _, in := range []string{"", "23:00", "23:00-", "25:00-08:00", "08:00-08:00"} {
+		if _, _, ok = parseQuiet(in); ok {
+			t.Errorf("Expected '%s' to be rejected", in)
+		}
+	}
+}
+
+func TestUserLocation(t *testing.T) {
+	if loc := userLocation("Unknown/Zone"); loc != time.UTC {
+		t.Errorf("Expected UTC for unknown timezone, but was %s", loc)
+	}
+
+	if loc := userLocation("Europe/Berlin"); loc.String() != "Europe/Berlin" {
+		t.Errorf("Expected Europe/Berlin, but was %s", loc)
+	}
+}
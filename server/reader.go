@@ -1,33 +1,54 @@
 package server
 
 import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/go-pkgz/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 
 	"github.com/vladikan/addrss-telegram/database"
 	"github.com/vladikan/addrss-telegram/parser"
 	"github.com/vladikan/addrss-telegram/templates"
 )
 
+// disabledRetry is an interval to probe disabled feeds, they are enabled back after successful read
+const disabledRetry = 7 * 24 * time.Hour
+
 // Reader holds reader settings
 type Reader struct {
-	Interval int
-	Feeds    int
-	DB       database.Database
-	Outbox   chan Reply
+	Interval    int
+	Feeds       int
+	Workers     int
+	PerHost     int
+	Retention   int
+	MinInterval int
+	MaxInterval int
+	MaxFailures int
+	DB          database.Database
+	Outbox      chan Reply
 
-	stop chan interface{}
+	stop    chan interface{}
+	done    chan interface{}
+	started time.Time
 }
 
 // Start will look for feed updates
 func (rd *Reader) Start() {
 	rd.stop = make(chan interface{})
+	rd.done = make(chan interface{})
+	rd.started = time.Now()
 
 	duration := time.Duration(rd.Interval) * time.Second
 	tick := time.NewTicker(duration)
 
 	go func() {
+		defer close(rd.done)
+
 		read := func() {
 			err := rd.readFeeds()
 			if err != nil {
@@ -49,10 +70,44 @@ func (rd *Reader) Start() {
 	}()
 }
 
-// Stop stops all reader activities
+// Stop stops all reader activities and waits till the current job is completed
 func (rd *Reader) Stop() {
-	log.Print("INFO Reader jobs terminated")
 	close(rd.stop)
+	<-rd.done
+	log.Print("INFO Reader jobs terminated")
+}
+
+func (rd *Reader) stopped() bool {
+	select {
+	case <-rd.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// ready checks that feeds were read successfully within a few intervals
+func (rd *Reader) ready(now time.Time) error {
+	limit := 3 * time.Duration(rd.Interval) * time.Second
+	last := rd.started
+	if at := readerLastSuccess.Load(); at > 0 {
+		last = time.Unix(at, 0)
+	}
+
+	if now.Sub(last) > limit {
+		return fmt.Errorf("no successful reader run since %s", last.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// readerStats aggregates job results across the workers
+type readerStats struct {
+	updated    atomic.Int64
+	notified   atomic.Int64
+	feeds      atomic.Int64
+	duplicates atomic.Int64
+	unmodified atomic.Int64
 }
 
 func (rd *Reader) readFeeds() error {
@@ -65,81 +120,392 @@ func (rd *Reader) readFeeds() error {
 		return err
 	}
 
-	stats := struct {
-		updated    int
-		notified   int
-		feeds      int
-		duplicates int
-	}{}
+	if rd.Retention > 0 {
+		if err = rd.DB.DeleteFeedItems(time.Now().AddDate(0, 0, -rd.Retention)); err != nil {
+			log.Printf("ERROR Reader unable to delete items history: %s", err)
+		}
+	}
+
+	workers := rd.Workers
+	if workers < 1 {
+		workers = 1
+	}
 
-	// Read feeds from servers
+	stats := &readerStats{}
+	hosts := newHostLimiter(rd.PerHost)
+	slots := make(chan struct{}, workers)
+
+	// Read feeds from servers. Host slot is taken before the worker one,
+	// so feeds of a busy host wait without holding workers from other hosts.
+	var wg sync.WaitGroup
 	for _, feed := range feeds {
-		updates, err := parser.GetUpdates(feed.URI, *feed.LastPub)
+		wg.Add(1)
+		go func(feed database.Feed) {
+			defer wg.Done()
+			release := hosts.acquire(feed.URI)
+			defer release()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-rd.stop:
+				return
+			}
+
+			// Feeds in progress are completed on stop, the rest are left for the next run
+			if rd.stopped() {
+				return
+			}
+
+			feedsPolled.Inc()
+			rd.readFeed(feed, stats)
+		}(feed)
+	}
+	wg.Wait()
+
+	if rd.stopped() {
+		log.Print("INFO Reader job interrupted by stop signal")
+		return nil
+	}
+
+	if stats.updated.Load() > 0 {
+		log.Printf("DEBUG Reader found %d new post(s) for %d feed(s) and notified %d subscription(s) (skipped %d duplicates)", stats.updated.Load(), stats.feeds.Load(), stats.notified.Load(), stats.duplicates.Load())
+	}
+
+	readerLastSuccess.Store(time.Now().Unix())
+	log.Printf("DEBUG Reader job completed. %d feeds updated (%d not modified). Next call in %s", len(feeds), stats.unmodified.Load(), time.Now().Add(duration))
+	return nil
+}
+
+func (rd *Reader) readFeed(feed database.Feed, stats *readerStats) {
+	cache := parser.Cache{ETag: feed.ETag, LastModified: feed.LastModified}
+	start := time.Now()
+	updates, cache, err := parser.GetUpdates(feed.URI, time.Time{}, cache)
+	fetchDuration.Observe(time.Since(start).Seconds())
+	if err == parser.ErrNotModified {
+		stats.unmodified.Add(1)
+		rd.setSchedule(feed, rd.nextInterval(feed, nil, cache, false))
+		if err = rd.DB.SetFeedUpdated(feed.ID); err != nil {
+			log.Printf("ERROR Feed '%s' unable mark as updated: %s", feed.Normalized, err)
+		}
+		return
+	} else if err != nil {
+		log.Printf("ERROR Feed '%s' unable get updates: %s", feed.Normalized, err)
+		fetchErrors.WithLabelValues(fetchErrorType(err)).Inc()
+		rd.setBroken(feed, cache, err)
+		return
+	}
+
+	rd.setSchedule(feed, rd.nextInterval(feed, updates, cache, true))
+
+	newUpdates, err := rd.filterSeen(feed, updates)
+	if err != nil {
+		log.Printf("ERROR Feed '%s' unable read items history: %s", feed.Normalized, err)
+		return
+	}
+	stats.duplicates.Add(int64(len(updates) - len(newUpdates)))
+
+	if len(newUpdates) > 0 {
+		users, err := rd.DB.GetFeedUsers(feed.ID)
 		if err != nil {
-			log.Printf("ERROR Feed '%s' unable get updates: %s", feed.Normalized, err)
-			rd.DB.SetFeedBroken(feed.ID)
-			continue
+			log.Printf("ERROR Feed '%s' unable get subscriptions: %s", feed.Normalized, err)
+			return
 		}
 
-		if len(updates) > 0 {
-			// Filter out already processed articles by URI
-			var newUpdates []parser.Topic
-			for _, update := range updates {
-				// Skip if this is the same URI as the last processed post
-				if feed.LastPubURI != "" && feed.LastPubURI == update.URI {
-					stats.duplicates++
-					continue
-				}
-				newUpdates = append(newUpdates, update)
-			}
+		stats.updated.Add(int64(len(newUpdates)))
+		stats.notified.Add(int64(len(users)))
+		stats.feeds.Add(1)
+		if len(users) > 0 {
+			rd.sendUpdates(newUpdates, users)
+		}
+	}
 
-			if len(newUpdates) > 0 {
-				users, err := rd.DB.GetFeedUsers(feed.ID)
-				if err != nil {
-					log.Printf("ERROR Feed '%s' unable get subscriptions: %s", feed.Normalized, err)
-					continue
-				}
+	// Items are marked as seen only after articles are queued, so failed reads are retried on the next poll
+	if err = rd.markSeen(feed, updates); err != nil {
+		log.Printf("ERROR Feed '%s' unable update items history: %s", feed.Normalized, err)
+		return
+	}
 
-				stats.updated += len(newUpdates)
-				stats.notified += len(users)
-				stats.feeds++
-				if len(users) > 0 {
-					rd.sendUpdates(newUpdates, users)
-				}
+	// Validators are stored only when articles are processed, otherwise server would answer
+	// "not modified" to the next read and the failed articles would never be delivered
+	if cache.ETag != feed.ETag || cache.LastModified != feed.LastModified {
+		if err = rd.DB.SetFeedCache(feed.ID, cache.ETag, cache.LastModified); err != nil {
+			log.Printf("ERROR Feed '%s' unable update cache validators: %s", feed.Normalized, err)
+		}
+	}
 
-				// Update last publication date and URI to the latest processed article
-				last := parser.GetLast(newUpdates)
-				err = rd.DB.SetFeedLastPub(feed.ID, *last.Date, last.URI)
-				if err != nil {
-					log.Printf("ERROR Feed '%s' unable update last pub date and URI: %s", feed.Normalized, err)
-					continue
-				}
-			}
+	// Update last publication date and URI to the latest processed article
+	if last := parser.GetLast(newUpdates); last != nil {
+		err = rd.DB.SetFeedLastPub(feed.ID, *last.Date, last.URI)
+		if err != nil {
+			log.Printf("ERROR Feed '%s' unable update last pub date and URI: %s", feed.Normalized, err)
+		}
+
+		return
+	}
+
+	err = rd.DB.SetFeedUpdated(feed.ID)
+	if err != nil {
+		log.Printf("ERROR Feed '%s' unable mark as updated: %s", feed.Normalized, err)
+	}
+}
+
+// nextInterval estimates feed polling interval by posting frequency and publisher hints
+func (rd *Reader) nextInterval(feed database.Feed, updates []parser.Topic, cache parser.Cache, modified bool) time.Duration {
+	interval := time.Duration(feed.CheckInterval) * time.Second
+	if modified {
+		// Check twice per average posting interval to deliver articles in time
+		interval = parser.GetFrequency(updates) / 2
+	}
+
+	if interval <= 0 {
+		interval = time.Duration(rd.Interval) * time.Second
+	}
+
+	if cache.TTL > interval {
+		interval = cache.TTL
+	}
+
+	if min := time.Duration(rd.MinInterval) * time.Second; interval < min {
+		interval = min
+	}
+
+	if max := time.Duration(rd.MaxInterval) * time.Second; max > 0 && interval > max {
+		interval = max
+	}
+
+	return interval
+}
+
+// backoff doubles retry interval for every failure in a row
+func (rd *Reader) backoff(failures int, ttl time.Duration) time.Duration {
+	retry := time.Duration(rd.MinInterval) * time.Second
+	if retry <= 0 {
+		retry = time.Duration(rd.Interval) * time.Second
+	}
+
+	max := time.Duration(rd.MaxInterval) * time.Second
+	for i := 1; i < failures && (max <= 0 || retry < max); i++ {
+		retry *= 2
+	}
+
+	if ttl > retry {
+		retry = ttl
+	}
+
+	if max > 0 && retry > max {
+		retry = max
+	}
+
+	return retry
+}
+
+// setBroken postpones feed by backoff or disables it and notifies subscribers after too many failures.
+// Disabled feeds are probed rarely, subscribers are notified only once.
+func (rd *Reader) setBroken(feed database.Feed, cache parser.Cache, reason error) {
+	feed.Failures++
+	feed.LastError = reason.Error()
+	if feed.Disabled {
+		if err := rd.DB.DisableFeed(feed.ID, feed.LastError, disabledRetry); err != nil {
+			log.Printf("ERROR Feed '%s' unable postpone probe: %s", feed.Normalized, err)
+		}
+		return
+	}
+
+	if rd.MaxFailures <= 0 || feed.Failures < rd.MaxFailures {
+		if err := rd.DB.SetFeedBroken(feed.ID, feed.LastError, rd.backoff(feed.Failures, cache.TTL)); err != nil {
+			log.Printf("ERROR Feed '%s' unable mark as broken: %s", feed.Normalized, err)
+		}
+		return
+	}
 
+	if err := rd.DB.DisableFeed(feed.ID, feed.LastError, disabledRetry); err != nil {
+		log.Printf("ERROR Feed '%s' unable disable: %s", feed.Normalized, err)
+		return
+	}
+
+	log.Printf("WARN Feed '%s' disabled after %d failures", feed.Normalized, feed.Failures)
+	users, err := rd.DB.GetFeedUsers(feed.ID)
+	if err != nil {
+		log.Printf("ERROR Feed '%s' unable get subscriptions: %s", feed.Normalized, err)
+		return
+	}
+
+	for _, usr := range users {
+		txt, _ := templates.ToTextW(usr.Lang, "feed-broken", feed)
+
+		// Channel subscribers can't manage subscriptions, so its owner is notified instead
+		if usr.ChannelOwner != 0 {
+			rd.Outbox <- Reply{ChatID: usr.ChannelOwner, Text: txt}
 			continue
 		}
 
-		err = rd.DB.SetFeedUpdated(feed.ID)
+		btn, _ := templates.ToText(usr.Lang, "button-remove")
+		markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(newButton(usr.UserID, btn, "unsubscribe", strconv.Itoa(feed.ID))))
+		rd.Outbox <- Reply{ChatID: usr.UserID, Text: txt, Markup: &markup}
+	}
+}
+
+func (rd *Reader) setSchedule(feed database.Feed, interval time.Duration) {
+	if err := rd.DB.SetFeedSchedule(feed.ID, interval); err != nil {
+		log.Printf("ERROR Feed '%s' unable update schedule: %s", feed.Normalized, err)
+	}
+}
+
+// filterSeen returns articles which were never seen before, items history is updated by markSeen after delivery.
+// When feed has no items history (new or reset feed) only articles after last publication date are returned.
+func (rd *Reader) filterSeen(feed database.Feed, updates []parser.Topic) ([]parser.Topic, error) {
+	items := feedItems(updates)
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+
+	added, err := rd.DB.GetNewFeedItems(feed.ID, guids)
+	if err != nil {
+		return nil, err
+	}
+
+	fresh := make(map[string]bool)
+	for _, guid := range added {
+		fresh[guid] = true
+	}
+
+	// All items are new either for the first read or when feed rotated its whole window
+	var firstSeen bool
+	if len(items) > 0 && len(added) == len(items) {
+		known, err := rd.DB.HasFeedItems(feed.ID)
 		if err != nil {
-			log.Printf("ERROR Feed '%s' unable mark as updated: %s", feed.Normalized, err)
+			return nil, err
+		}
+		firstSeen = !known
+	}
+
+	var rst []parser.Topic
+	for _, upd := range updates {
+		if !fresh[upd.GUID] {
+			continue
+		}
+		delete(fresh, upd.GUID)
+
+		if firstSeen && (upd.Date == nil || feed.LastPub == nil || !upd.Date.After(*feed.LastPub)) {
 			continue
 		}
+
+		rst = append(rst, upd)
 	}
 
-	if stats.updated > 0 {
-		log.Printf("DEBUG Reader found %d new post(s) for %d feed(s) and notified %d subscription(s) (skipped %d duplicates)", stats.updated, stats.feeds, stats.notified, stats.duplicates)
+	return rst, nil
+}
+
+// markSeen stores items history, so queued articles are not sent again
+func (rd *Reader) markSeen(feed database.Feed, updates []parser.Topic) error {
+	return rd.DB.AddFeedItems(feed.ID, feedItems(updates))
+}
+
+// feedItems returns unique feed items of the articles
+func feedItems(updates []parser.Topic) []database.FeedItem {
+	var items []database.FeedItem
+	known := make(map[string]bool)
+	for _, upd := range updates {
+		if !known[upd.GUID] {
+			known[upd.GUID] = true
+			items = append(items, database.FeedItem{GUID: upd.GUID, Title: upd.Title, URI: upd.URI, Date: upd.Date})
+		}
 	}
 
-	log.Printf("DEBUG Reader job completed. %d feeds updated. Next call in %s", len(feeds), time.Now().Add(duration))
-	return nil
+	return items
 }
 
 func (rd *Reader) sendUpdates(updates []parser.Topic, users []database.UserFeed) {
+	now := time.Now()
+	filters := make([]*filter, len(users))
+	for i, usr := range users {
+		filters[i] = newFilter(usr.Filters)
+	}
+
 	for _, upd := range updates {
-		txt, _ := templates.ToTextW("en", "topic", upd)
+		texts := make(map[string]string)
+
+		for i, usr := range users {
+			if !filters[i].allow(upd) {
+				continue
+			}
+
+			// Articles are held in digest queue during quiet hours and released by digester after them
+			quiet := inQuietHours(usr.Quiet, usr.Timezone, now)
+			if (len(usr.Digest) > 0 && usr.Digest != digestInstant) || (quiet && usr.Quiet.Mode == quietHold) {
+				item := database.DigestItem{UserID: usr.UserID, Feed: upd.Feed, Title: upd.Title, URI: upd.URI, Date: upd.Date}
+				if err := rd.DB.AddDigestItem(item); err != nil {
+					log.Printf("ERROR User %d unable queue digest item: %s", usr.UserID, err)
+				}
+				continue
+			}
 
-		for _, usr := range users {
-			rd.Outbox <- Reply{ChatID: usr.UserID, Text: txt}
+			txt, ok := texts[usr.Lang]
+			if !ok {
+				txt, _ = templates.ToTextW(usr.Lang, "topic", upd)
+				texts[usr.Lang] = txt
+			}
+
+			reply := Reply{ChatID: usr.UserID, Text: txt, Silent: quiet}
+			if usr.ChannelOwner == 0 {
+				markup := articleMarkup(usr, upd)
+				reply.Markup = &markup
+			}
+
+			rd.Outbox <- reply
+			itemsDelivered.WithLabelValues(digestInstant).Inc()
 		}
 	}
 }
+
+// articleMarkup creates article actions keyboard for the subscriber
+func articleMarkup(usr database.UserFeed, upd parser.Topic) tgbotapi.InlineKeyboardMarkup {
+	feedID := strconv.Itoa(usr.FeedID)
+	save, _ := templates.ToText(usr.Lang, "button-save")
+	mute, _ := templates.ToText(usr.Lang, "button-mute")
+	unsubscribe, _ := templates.ToText(usr.Lang, "button-unsubscribe")
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			newButton(usr.UserID, save, "save", feedID+" "+database.ItemKey(upd.GUID)),
+			newButton(usr.UserID, mute, "mute", feedID),
+		),
+		tgbotapi.NewInlineKeyboardRow(newButton(usr.UserID, unsubscribe, "unsubscribe", feedID)),
+	)
+}
+
+// hostLimiter bounds the number of concurrent requests to the same host
+type hostLimiter struct {
+	limit int
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	if limit < 1 {
+		limit = 1
+	}
+
+	return &hostLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// acquire blocks until the uri host has a free slot and returns the release func
+func (hl *hostLimiter) acquire(uri string) func() {
+	host := uri
+	if u, err := url.Parse(uri); err == nil && len(u.Hostname()) > 0 {
+		host = u.Hostname()
+	}
+
+	hl.mu.Lock()
+	slot, ok := hl.slots[host]
+	if !ok {
+		slot = make(chan struct{}, hl.limit)
+		hl.slots[host] = slot
+	}
+	hl.mu.Unlock()
+
+	slot <- struct{}{}
+	return func() { <-slot }
+}
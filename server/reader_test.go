@@ -0,0 +1,385 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vladikan/addrss-telegram/database"
+	"github.com/vladikan/addrss-telegram/parser"
+)
+
+func TestHostLimiter_SameHostIsLimited(t *testing.T) {
+	hl := newHostLimiter(1)
+	release := hl.acquire("https://example.com/feed1.rss")
+
+	acquired := make(chan interface{})
+	go func() {
+		hl.acquire("https://example.com/feed2.rss")()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Errorf("Expected second acquire to wait for the release")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Errorf("Expected second acquire to complete after the release")
+	}
+}
+
+func TestHostLimiter_OtherHostIsNotLimited(t *testing.T) {
+	hl := newHostLimiter(1)
+	defer hl.acquire("https://example.com/feed.rss")()
+
+	acquired := make(chan interface{})
+	go func() {
+		hl.acquire("https://example.org/feed.rss")()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Errorf("Expected acquire for another host to complete")
+	}
+}
+
+func TestReadFeeds_BusyHostKeepsWorkersFree(t *testing.T) {
+	release := make(chan interface{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`<rss version="2.0"><channel><title>Slow</title></channel></rss>`))
+	}))
+	defer slow.Close()
+
+	read := make(chan interface{})
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(read)
+		w.Write([]byte(`<rss version="2.0"><channel><title>Fast</title></channel></rss>`))
+	}))
+	defer fast.Close()
+
+	// Both slow feeds share the host, the fast one is served by another host name
+	feeds := []database.Feed{{URI: slow.URL + "/1"}, {URI: slow.URL + "/2"}, {URI: strings.Replace(fast.URL, "127.0.0.1", "localhost", 1)}}
+	rd := &Reader{Interval: 60, Workers: 2, PerHost: 1, DB: &dbMock{
+		getFeedsMock:        func() ([]database.Feed, error) { return feeds, nil },
+		setFeedScheduleMock: func() error { return nil },
+		getNewFeedItemsMock: func() ([]string, error) { return nil, nil },
+		addFeedItemsMock:    func() error { return nil },
+		setFeedUpdatedMock:  func() error { return nil },
+	}}
+
+	done := make(chan error)
+	go func() { done <- rd.readFeeds() }()
+
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Errorf("Expected feed of another host to be read while the busy host is waited")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Error was not expected, but was '%s'", err)
+	}
+}
+
+func TestReadFeed_CacheStoredAfterDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte(`<rss version="2.0"><channel><title>Test</title><item><guid>1</guid></item><item><guid>2</guid></item></channel></rss>`))
+	}))
+	defer srv.Close()
+
+	cached := false
+	usersErr := errors.New("test")
+	rd := &Reader{Outbox: make(chan Reply, 10), DB: &dbMock{
+		setFeedScheduleMock: func() error { return nil },
+		getNewFeedItemsMock: func() ([]string, error) { return []string{"2"}, nil },
+		addFeedItemsMock:    func() error { return nil },
+		getFeedUsersMock:    func() ([]database.UserFeed, error) { return nil, usersErr },
+		setFeedCacheMock:    func() error { cached = true; return nil },
+		setFeedUpdatedMock:  func() error { return nil },
+	}}
+
+	rd.readFeed(database.Feed{URI: srv.URL, ETag: `"v1"`}, &readerStats{})
+	if cached {
+		t.Errorf("Expected cache validators to be kept when articles are not delivered")
+	}
+
+	usersErr = nil
+	rd.readFeed(database.Feed{URI: srv.URL, ETag: `"v1"`}, &readerStats{})
+	if !cached {
+		t.Errorf("Expected cache validators to be stored after delivery")
+	}
+}
+
+func TestReadFeed_SeenAfterDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<rss version="2.0"><channel><title>Test</title><item><guid>1</guid></item><item><guid>2</guid></item></channel></rss>`))
+	}))
+	defer srv.Close()
+
+	marked := false
+	usersErr := errors.New("test")
+	rd := &Reader{Outbox: make(chan Reply, 10), DB: &dbMock{
+		setFeedScheduleMock: func() error { return nil },
+		getNewFeedItemsMock: func() ([]string, error) { return []string{"2"}, nil },
+		addFeedItemsMock:    func() error { marked = true; return nil },
+		getFeedUsersMock: func() ([]database.UserFeed, error) {
+			return []database.UserFeed{{UserID: 1}}, usersErr
+		},
+		setFeedUpdatedMock: func() error { return nil },
+	}}
+
+	rd.readFeed(database.Feed{URI: srv.URL}, &readerStats{})
+	if marked {
+		t.Errorf("Expected items to stay unseen when subscriptions are not read")
+	}
+
+	usersErr = nil
+	rd.readFeed(database.Feed{URI: srv.URL}, &readerStats{})
+	if !marked || len(rd.Outbox) != 1 {
+		t.Errorf("Expected items to be marked after the article is queued, queued %d", len(rd.Outbox))
+	}
+}
+
+func TestFilterSeen_SkipsKnownItems(t *testing.T) {
+	rd := &Reader{DB: &dbMock{
+		getNewFeedItemsMock: func() ([]string, error) { return []string{"2"}, nil },
+	}}
+
+	updates := []parser.Topic{{GUID: "1"}, {GUID: "2"}, {GUID: "2"}}
+	rst, err := rd.filterSeen(database.Feed{}, updates)
+	if err != nil {
+		t.Errorf("Error was not expected, but was '%s'", err)
+	}
+
+	if len(rst) != 1 || rst[0].GUID != "2" {
+		t.Errorf("Expected single item '2', but was '%v'", rst)
+	}
+}
+
+func TestFilterSeen_FirstSeenUsesLastPub(t *testing.T) {
+	rd := &Reader{DB: &dbMock{
+		getNewFeedItemsMock: func() ([]string, error) { return []string{"1", "2", "3"}, nil },
+		hasFeedItemsMock:    func() (bool, error) { return false, nil },
+	}}
+
+	now := time.Now()
+	before := now.Add(-1 * time.Hour)
+	after := now.Add(1 * time.Hour)
+	updates := []parser.Topic{{GUID: "1", Date: &before}, {GUID: "2", Date: &after}, {GUID: "3"}}
+
+	rst, err := rd.filterSeen(database.Feed{LastPub: &now}, updates)
+	if err != nil {
+		t.Errorf("Error was not expected, but was '%s'", err)
+	}
+
+	if len(rst) != 1 || rst[0].GUID != "2" {
+		t.Errorf("Expected single item '2', but was '%v'", rst)
+	}
+}
+
+func TestFilterSeen_RotatedFeedDeliversAll(t *testing.T) {
+	rd := &Reader{DB: &dbMock{
+		getNewFeedItemsMock: func() ([]string, error) { return []string{"1", "2", "3"}, nil },
+		hasFeedItemsMock:    func() (bool, error) { return true, nil },
+	}}
+
+	now := time.Now()
+	before := now.Add(-1 * time.Hour)
+	after := now.Add(1 * time.Hour)
+	updates := []parser.Topic{{GUID: "1", Date: &before}, {GUID: "2", Date: &after}, {GUID: "3"}}
+
+	rst, err := rd.filterSeen(database.Feed{LastPub: &now}, updates)
+	if err != nil {
+		t.Errorf("Error was not expected, but was '%s'", err)
+	}
+
+	if len(rst) != 3 {
+		t.Errorf("Expected all rotated items, but was '%v'", rst)
+	}
+}
+
+func TestSendUpdates_AddsArticleActions(t *testing.T) {
+	callbackKey = []byte("test")
+	rd := &Reader{Outbox: make(chan Reply, 10)}
+	users := []database.UserFeed{{UserID: 1, FeedID: 5}, {UserID: 2, FeedID: 5}}
+
+	rd.sendUpdates([]parser.Topic{{GUID: "1"}}, users)
+	close(rd.Outbox)
+
+	var chats []int64
+	for reply := range rd.Outbox {
+		chats = append(chats, reply.ChatID)
+		if reply.Markup == nil || len(reply.Markup.InlineKeyboard) != 2 {
+			t.Errorf("Expected article actions keyboard for chat %d", reply.ChatID)
+			continue
+		}
+
+		if _, ok := verifyCallback(reply.ChatID, *reply.Markup.InlineKeyboard[0][0].CallbackData); !ok {
+			t.Errorf("Expected buttons to be signed for chat %d", reply.ChatID)
+		}
+	}
+
+	if len(chats) != 2 {
+		t.Errorf("Expected updates for 2 chats, but was %v", chats)
+	}
+}
+
+func TestSendUpdates_ChannelWithoutActions(t *testing.T) {
+	rd := &Reader{Outbox: make(chan Reply, 10)}
+	rd.sendUpdates([]parser.Topic{{GUID: "1"}}, []database.UserFeed{{UserID: -100, FeedID: 5, ChannelOwner: 1}})
+	close(rd.Outbox)
+
+	reply := <-rd.Outbox
+	if reply.ChatID != -100 || reply.Markup != nil {
+		t.Errorf("Expected channel update without keyboard, but was %+v", reply)
+	}
+}
+
+func TestSendUpdates_QuietHours(t *testing.T) {
+	held := 0
+	rd := &Reader{Outbox: make(chan Reply, 10), DB: &dbMock{
+		addDigestItemMock: func() error { held++; return nil },
+	}}
+
+	from := time.Now().UTC().Hour() * 60
+	to := (from + 60) % (24 * 60)
+	users := []database.UserFeed{
+		{UserID: 1, Quiet: database.Quiet{Mode: quietHold, From: from, To: to}},
+		{UserID: 2, Quiet: database.Quiet{Mode: quietSilent, From: from, To: to}},
+		{UserID: 3},
+	}
+
+	rd.sendUpdates([]parser.Topic{{GUID: "1"}}, users)
+	close(rd.Outbox)
+
+	silent := make(map[int64]bool)
+	for reply := range rd.Outbox {
+		silent[reply.ChatID] = reply.Silent
+	}
+
+	if held != 1 {
+		t.Errorf("Expected single held article, but was %d", held)
+	}
+
+	if s, ok := silent[2]; !ok || !s {
+		t.Errorf("Expected silent update for chat 2")
+	}
+
+	if s, ok := silent[3]; !ok || s {
+		t.Errorf("Expected regular update for chat 3")
+	}
+}
+
+func TestNextInterval_Bounds(t *testing.T) {
+	rd := &Reader{Interval: 600, MinInterval: 600, MaxInterval: 3600}
+
+	now := time.Now()
+	rst := rd.nextInterval(database.Feed{}, []parser.Topic{{Date: &now}}, parser.Cache{}, true)
+	if rst != 600*time.Second {
+		t.Errorf("Expected min interval, but was %s", rst)
+	}
+
+	rst = rd.nextInterval(database.Feed{}, nil, parser.Cache{TTL: 24 * time.Hour}, true)
+	if rst != 3600*time.Second {
+		t.Errorf("Expected max interval, but was %s", rst)
+	}
+}
+
+func TestNextInterval_NotModifiedKeepsInterval(t *testing.T) {
+	rd := &Reader{Interval: 600, MinInterval: 600, MaxInterval: 86400}
+
+	rst := rd.nextInterval(database.Feed{CheckInterval: 7200}, nil, parser.Cache{}, false)
+	if rst != 2*time.Hour {
+		t.Errorf("Expected previous interval, but was %s", rst)
+	}
+}
+
+func TestBackoff_Doubles(t *testing.T) {
+	rd := &Reader{MinInterval: 600, MaxInterval: 3600}
+
+	if rst := rd.backoff(1, 0); rst != 10*time.Minute {
+		t.Errorf("Expected 10m, but was %s", rst)
+	}
+
+	if rst := rd.backoff(3, 0); rst != 40*time.Minute {
+		t.Errorf("Expected 40m, but was %s", rst)
+	}
+
+	if rst := rd.backoff(10, 0); rst != time.Hour {
+		t.Errorf("Expected max interval, but was %s", rst)
+	}
+}
+
+func TestBackoff_RetryAfter(t *testing.T) {
+	rd := &Reader{MinInterval: 600, MaxInterval: 3600}
+
+	if rst := rd.backoff(1, 30*time.Minute); rst != 30*time.Minute {
+		t.Errorf("Expected 30m, but was %s", rst)
+	}
+}
+
+func TestSetBroken_NotifiesOnce(t *testing.T) {
+	disabled := 0
+	rd := &Reader{MaxFailures: 2, Outbox: make(chan Reply, 10), DB: &dbMock{
+		disableFeedMock:  func() error { disabled++; return nil },
+		getFeedUsersMock: func() ([]database.UserFeed, error) { return []database.UserFeed{{UserID: 1}}, nil },
+	}}
+
+	rd.setBroken(database.Feed{Failures: 1}, parser.Cache{}, errors.New("<bad>"))
+	if disabled != 1 || len(rd.Outbox) != 1 {
+		t.Fatalf("Expected feed to be disabled with notification, but was %d disabled and %d sent", disabled, len(rd.Outbox))
+	}
+
+	rd.setBroken(database.Feed{Failures: 2, Disabled: true}, parser.Cache{}, errors.New("<bad>"))
+	if disabled != 2 || len(rd.Outbox) != 1 {
+		t.Errorf("Expected failed probe to postpone feed silently, but was %d disabled and %d sent", disabled, len(rd.Outbox))
+	}
+}
+
+func TestReader_StopWaitsForJob(t *testing.T) {
+	release := make(chan interface{})
+	started := make(chan interface{})
+	rd := &Reader{Interval: 60, DB: &dbMock{
+		getFeedsMock: func() ([]database.Feed, error) {
+			close(started)
+			<-release
+			return nil, errors.New("test")
+		},
+	}}
+
+	rd.Start()
+	<-started
+
+	stopped := make(chan interface{})
+	go func() {
+		rd.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatalf("Expected reader to wait for the running job")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("Expected reader to stop after the job is completed")
+	}
+}
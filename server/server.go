@@ -4,8 +4,8 @@ import (
 	"context"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/go-pkgz/lgr"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -15,18 +15,33 @@ import (
 
 // Options holds all necessary settings for the app
 type Options struct {
-	Token          string
-	Connection     string
-	Debug          bool
-	ReaderInterval int
-	ReaderFeeds    int
-	BotAdmin       int64
+	Token             string
+	Connection        string
+	Debug             bool
+	ReaderInterval    int
+	ReaderFeeds       int
+	ReaderWorkers     int
+	ReaderPerHost     int
+	ReaderRetention   int
+	ReaderMinInterval int
+	ReaderMaxInterval int
+	ReaderMaxFailures int
+	BotAdmin          int64
+	Templates         string
+	WebhookURL        string
+	WebhookListen     string
+	WebhookCert       string
+	WebhookKey        string
+	WebhookSecret     string
+	MetricsListen     string
 }
 
 // Reply is a message to be sent to user/chat
 type Reply struct {
 	ChatID int64
 	Text   string
+	Markup *tgbotapi.InlineKeyboardMarkup
+	Silent bool
 }
 
 var bot *tgbotapi.BotAPI
@@ -34,6 +49,10 @@ var db database.Database
 
 // Start will call for bot instance and process update messages
 func Start(options Options) {
+	if err := templates.SetTemplateOutput(options.Templates); err != nil {
+		log.Printf("PANIC Error while loading templates: %s", err)
+	}
+
 	bt, err := tgbotapi.NewBotAPI(options.Token)
 	if err != nil {
 		log.Printf("PANIC Error while creating bot instance: %s", err)
@@ -41,6 +60,7 @@ func Start(options Options) {
 
 	bot = bt
 	bot.Debug = options.Debug
+	callbackKey = []byte(options.Token)
 	log.Printf("INFO Authorized on account %s", bot.Self.UserName)
 
 	cfg := tgbotapi.NewUpdate(0)
@@ -50,31 +70,93 @@ func Start(options Options) {
 	ctx, cancel := context.WithCancel(context.Background())
 	go handleTerminate(cancel)
 
-	templates.SetTemplateOutput()
-
-	// Set db connection settings and use pool
-	db, err = database.Open(ctx, options.Connection)
+	// Set db connection settings and use pool, it should outlive terminate signal to complete shutdown
+	db, err = database.Open(context.Background(), options.Connection)
 	if err != nil {
 		log.Printf("PANIC Error while connecting to the database: %s", err)
 	}
 	defer db.Close()
 
-	// Init messages channel
+	// Init messages channel backed by outbox
+	dispatcher := &Dispatcher{DB: db}
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
 	replyQueue := make(chan Reply)
-	go handleReply(replyQueue)
-	defer close(replyQueue)
+	repliesDone := make(chan interface{})
+	go handleReply(replyQueue, dispatcher, repliesDone)
+	defer func() {
+		// All writers are stopped at this point, wait till the rest of replies are persisted
+		close(replyQueue)
+		<-repliesDone
+	}()
 
 	// Start reader
-	reader := &Reader{Interval: options.ReaderInterval, Feeds: options.ReaderFeeds, DB: db, Outbox: replyQueue}
+	reader := &Reader{
+		Interval:    options.ReaderInterval,
+		Feeds:       options.ReaderFeeds,
+		Workers:     options.ReaderWorkers,
+		PerHost:     options.ReaderPerHost,
+		Retention:   options.ReaderRetention,
+		MinInterval: options.ReaderMinInterval,
+		MaxInterval: options.ReaderMaxInterval,
+		MaxFailures: options.ReaderMaxFailures,
+		DB:          db,
+		Outbox:      replyQueue,
+	}
 	reader.Start()
 	defer reader.Stop()
 
-	// Read commands from users
-	updates, _ := bot.GetUpdatesChan(cfg)
-	go handleRequests(updates, replyQueue, &options)
-	defer bot.StopReceivingUpdates()
+	// Expose metrics and health checks
+	if len(options.MetricsListen) > 0 {
+		stopStatus := startStatus(options.MetricsListen, func() error {
+			if err := db.Ping(); err != nil {
+				return err
+			}
+			return reader.ready(time.Now())
+		})
+		defer stopStatus()
+	}
+
+	// Start digests delivery
+	digester := &Digester{DB: db, Outbox: replyQueue}
+	digester.Start()
+	defer digester.Stop()
+
+	// Read commands from users with webhook or long polling
+	var updates tgbotapi.UpdatesChannel
+	requestsStop := make(chan interface{})
+	requestsDone := make(chan interface{})
+	defer func() {
+		// Let the current command complete
+		close(requestsStop)
+		<-requestsDone
+	}()
+
+	if len(options.WebhookURL) > 0 {
+		webhook := &Webhook{
+			URL:      options.WebhookURL,
+			Listen:   options.WebhookListen,
+			CertFile: options.WebhookCert,
+			KeyFile:  options.WebhookKey,
+			Secret:   options.WebhookSecret,
+		}
 
-	// Stop bot operations and close all connections
+		if updates, err = webhook.Start(); err != nil {
+			log.Printf("PANIC Error while setting webhook: %s", err)
+		}
+		defer webhook.Stop()
+	} else {
+		if _, err = bot.RemoveWebhook(); err != nil {
+			log.Printf("WARN Unable to deregister webhook: %s", err)
+		}
+
+		updates, _ = bot.GetUpdatesChan(cfg)
+		defer bot.StopReceivingUpdates()
+	}
+	go handleRequests(updates, replyQueue, &options, requestsStop, requestsDone)
+
+	// Stop bot operations and close all connections in reverse order
 	<-ctx.Done()
 
 	log.Print("INFO Stoping updates processing")
@@ -90,15 +172,38 @@ func handleTerminate(cancel context.CancelFunc) {
 	cancel()
 }
 
-func handleRequests(updates tgbotapi.UpdatesChannel, replyQueue chan Reply, opt *Options) {
+func handleRequests(updates tgbotapi.UpdatesChannel, replyQueue chan Reply, opt *Options, stop chan interface{}, done chan interface{}) {
+	defer close(done)
+
 	log.Print("INFO Start updates processing")
-	for update := range updates {
-		msg := update.Message
-		if msg == nil {
+	for {
+		var update tgbotapi.Update
+		var ok bool
+		select {
+		case <-stop:
+			log.Print("INFO Updates processing stopped")
+			return
+		case update, ok = <-updates:
+		}
+
+		if !ok {
+			break
+		}
+
+		var cmd *Command
+		if query := update.CallbackQuery; query != nil && query.Message != nil {
+			bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, ""))
+			if cmd = newCallbackCommand(query, opt, replyQueue); cmd == nil {
+				continue
+			}
+		} else if msg := update.Message; msg != nil {
+			if cmd = newCommand(msg, opt, replyQueue); cmd == nil {
+				continue
+			}
+		} else {
 			continue
 		}
 
-		cmd := newCommand(msg, opt, replyQueue)
 		replies := cmd.run()
 		for _, reply := range replies {
 			replyQueue <- reply
@@ -108,21 +213,31 @@ func handleRequests(updates tgbotapi.UpdatesChannel, replyQueue chan Reply, opt
 	log.Print("INFO Updates channel was closed")
 }
 
-func handleReply(queue chan Reply) {
+func handleReply(queue chan Reply, dispatcher *Dispatcher, done chan interface{}) {
+	defer close(done)
+
 	for msg := range queue {
-		rsp := tgbotapi.NewMessage(msg.ChatID, msg.Text)
-		rsp.ParseMode = "HTML"
+		repliesQueued.Inc()
+		dispatcher.Push(msg)
+	}
 
-		if _, err := bot.Send(rsp); err != nil {
-			if strings.Contains(strings.ToLower(err.Error()), "forbidden") {
-				db.DeleteUser(msg.ChatID)
-				log.Printf("WARN user %d is blocked the bot and now deleted", msg.ChatID)
-				continue
-			}
+	log.Print("INFO Reply queue channel was closed")
+}
 
-			log.Printf("ERROR %T Problem while replying on %d chat: %s", err, msg.ChatID, err)
-		}
+func sendReply(msg Reply) error {
+	rsp := tgbotapi.NewMessage(msg.ChatID, msg.Text)
+	rsp.ParseMode = "HTML"
+	rsp.DisableNotification = msg.Silent
+	if msg.Markup != nil {
+		rsp.ReplyMarkup = msg.Markup
 	}
 
-	log.Print("INFO Reply queue channel was closed")
+	_, err := bot.Send(rsp)
+	return err
+}
+
+func sendDocument(chatID int64, name string, data []byte) error {
+	doc := tgbotapi.NewDocumentUpload(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	_, err := bot.Send(doc)
+	return err
 }
@@ -1,8 +1,17 @@
 package server
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
 func normalize(in string) string {
@@ -52,3 +61,58 @@ func splitNonEmpty(in string) []string {
 
 	return rst
 }
+
+// validURI checks if value is an absolute http or https address
+func validURI(in string) bool {
+	u, err := url.Parse(in)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0
+}
+
+// maxPeriodDays limits periods, so they can't overflow the duration
+const maxPeriodDays = 365
+
+// parsePeriod reads positive duration in Go format with additional days suffix, like 3d or 12h
+func parsePeriod(in string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(in, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 || n > maxPeriodDays {
+			return 0, false
+		}
+		return time.Duration(n) * 24 * time.Hour, true
+	}
+
+	period, err := time.ParseDuration(in)
+	return period, err == nil && period > 0 && period <= maxPeriodDays*24*time.Hour
+}
+
+// callbackKey signs inline buttons data, so callbacks can't be forged for another chat or command
+var callbackKey []byte
+
+const callbackSignLength = 8
+
+// newButton creates inline button which calls command verb with args, data is signed for the chat
+func newButton(chatID int64, text string, verb string, args string) tgbotapi.InlineKeyboardButton {
+	data := verb + " " + args
+	return tgbotapi.NewInlineKeyboardButtonData(text, data+" "+signCallback(chatID, data))
+}
+
+// verifyCallback checks inline button data signature and returns data without it
+func verifyCallback(chatID int64, data string) (string, bool) {
+	i := strings.LastIndex(data, " ")
+	if i < 0 {
+		return emptyText, false
+	}
+
+	payload, sign := data[:i], data[i+1:]
+	return payload, hmac.Equal([]byte(sign), []byte(signCallback(chatID, payload)))
+}
+
+func signCallback(chatID int64, data string) string {
+	mac := hmac.New(sha256.New, callbackKey)
+	fmt.Fprintf(mac, "%d:%s", chatID, data)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:callbackSignLength]
+}
@@ -2,7 +2,9 @@ package server
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNormalize(t *testing.T) {
@@ -90,3 +92,69 @@ func TestSplitNonEmpty(t *testing.T) {
 		t.Errorf("[1] Expected \"2\", but got \"%s\"", rst[1])
 	}
 }
+
+func TestValidURI(t *testing.T) {
+	cases := map[string]bool{
+		"http://example.com/rss": true,
+		"https://example.com":    true,
+		"ftp://example.com/rss":  false,
+		"example.com/rss":        false,
+		"http://":                false,
+		"":                       false,
+	}
+
+	for in, exp := range cases {
+		if rst := validURI(in); rst != exp {
+			t.Errorf("Expected '%v' for '%s', but was '%v'", exp, in, rst)
+		}
+	}
+}
+
+func TestCallback_Signed(t *testing.T) {
+	callbackKey = []byte("test")
+	btn := newButton(1, "text", "save", "12345 0123456789ab")
+	if len(*btn.CallbackData) > 64 {
+		t.Errorf("Expected callback data to fit 64 bytes, but was %d", len(*btn.CallbackData))
+	}
+
+	data, ok := verifyCallback(1, *btn.CallbackData)
+	if !ok || data != "save 12345 0123456789ab" {
+		t.Errorf("Expected valid 'save 12345 0123456789ab' data, but was '%s' (%v)", data, ok)
+	}
+
+	if _, ok = verifyCallback(2, *btn.CallbackData); ok {
+		t.Errorf("Expected data to be rejected for another chat")
+	}
+
+	forged := strings.Replace(*btn.CallbackData, "12345", "12346", 1)
+	if _, ok = verifyCallback(1, forged); ok {
+		t.Errorf("Expected changed data to be rejected")
+	}
+
+	if _, ok = verifyCallback(1, "unsubscribe"); ok {
+		t.Errorf("Expected unsigned data to be rejected")
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	cases := map[string]time.Duration{
+		"3d":                   72 * time.Hour,
+		"12h":                  12 * time.Hour,
+		"30m":                  30 * time.Minute,
+		"365d":                 365 * 24 * time.Hour,
+		"0d":                   0,
+		"-1h":                  0,
+		"d":                    0,
+		"3x":                   0,
+		"366d":                 0,
+		"8761h":                0,
+		"9223372036854775807d": 0,
+	}
+
+	for in, exp := range cases {
+		rst, ok := parsePeriod(in)
+		if ok != (exp > 0) || (ok && rst != exp) {
+			t.Errorf("Expected '%s' for '%s', but was '%s' (%v)", exp, in, rst, ok)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	webhookMaxBody      = 1 << 20
+	webhookTimeout      = 10 * time.Second
+)
+
+// Webhook receives updates from Telegram over HTTP as an alternative to long polling
+type Webhook struct {
+	URL      string
+	Listen   string
+	CertFile string
+	KeyFile  string
+	Secret   string
+
+	server  *http.Server
+	updates chan tgbotapi.Update
+	stop    chan interface{}
+}
+
+// Start registers webhook and serves incoming updates
+func (wh *Webhook) Start() (tgbotapi.UpdatesChannel, error) {
+	link, err := url.Parse(wh.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Listen synchronously so bind and certificate failures are returned to the caller
+	listener, err := net.Listen("tcp", wh.Listen)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if len(wh.CertFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(wh.CertFile, wh.KeyFile)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	wh.updates = make(chan tgbotapi.Update, bot.Buffer)
+	wh.stop = make(chan interface{})
+
+	pattern := link.Path
+	if len(pattern) == 0 {
+		pattern = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(pattern, wh)
+	wh.server = &http.Server{
+		Addr:         wh.Listen,
+		Handler:      mux,
+		ReadTimeout:  webhookTimeout,
+		WriteTimeout: webhookTimeout,
+		TLSConfig:    tlsConfig,
+	}
+
+	log.Printf("INFO Listening for webhook updates on %s%s", listener.Addr(), pattern)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = wh.server.ServeTLS(listener, "", "")
+		} else {
+			err = wh.server.Serve(listener)
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("ERROR Webhook server fault: %s", err)
+		}
+	}()
+
+	if err = wh.register(link); err != nil {
+		wh.shutdown()
+		return nil, err
+	}
+
+	return wh.updates, nil
+}
+
+// Stop deregisters webhook and stops updates receiving
+func (wh *Webhook) Stop() {
+	if _, err := bot.RemoveWebhook(); err != nil {
+		log.Printf("ERROR Unable to deregister webhook: %s", err)
+	}
+
+	wh.shutdown()
+	log.Print("INFO Webhook terminated")
+}
+
+// shutdown releases handlers waiting for the queue, updates are closed only when no handler is left to write them
+func (wh *Webhook) shutdown() {
+	close(wh.stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	if err := wh.server.Shutdown(ctx); err != nil {
+		log.Printf("ERROR Webhook server shutdown: %s", err)
+		return
+	}
+
+	close(wh.updates)
+}
+
+// register sets webhook with secret token, self signed certificate is uploaded when specified
+func (wh *Webhook) register(link *url.URL) error {
+	params := map[string]string{"url": link.String()}
+	if len(wh.Secret) > 0 {
+		params["secret_token"] = wh.Secret
+	}
+
+	var err error
+	if len(wh.CertFile) > 0 {
+		_, err = bot.UploadFile("setWebhook", params, "certificate", wh.CertFile)
+	} else {
+		values := url.Values{}
+		for key, value := range params {
+			values.Set(key, value)
+		}
+		_, err = bot.MakeRequest("setWebhook", values)
+	}
+
+	return err
+}
+
+// ServeHTTP checks Telegram secret header and passes update to the processing
+func (wh *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(wh.Secret) > 0 && subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(wh.Secret)) != 1 {
+		log.Printf("WARN Webhook request from %s with wrong secret token", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(io.LimitReader(r.Body, webhookMaxBody)).Decode(&update); err != nil {
+		log.Printf("WARN Webhook request with broken update: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Telegram retries updates which are not accepted
+	select {
+	case wh.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-wh.stop:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestWebhook_WrongMethod(t *testing.T) {
+	wh := &Webhook{updates: make(chan tgbotapi.Update, 1)}
+	rsp := httptest.NewRecorder()
+	wh.ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/hook", nil))
+
+	if rsp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d status, but was %d", http.StatusMethodNotAllowed, rsp.Code)
+	}
+}
+
+func TestWebhook_WrongSecret(t *testing.T) {
+	wh := &Webhook{Secret: "secret", updates: make(chan tgbotapi.Update, 1)}
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"update_id":1}`))
+	req.Header.Set(webhookSecretHeader, "wrong")
+
+	rsp := httptest.NewRecorder()
+	wh.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d status, but was %d", http.StatusUnauthorized, rsp.Code)
+	}
+
+	if len(wh.updates) != 0 {
+		t.Errorf("Expected no updates, but was %d", len(wh.updates))
+	}
+}
+
+func TestWebhook_BrokenBody(t *testing.T) {
+	wh := &Webhook{updates: make(chan tgbotapi.Update, 1)}
+	rsp := httptest.NewRecorder()
+	wh.ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("{")))
+
+	if rsp.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d status, but was %d", http.StatusBadRequest, rsp.Code)
+	}
+}
+
+func TestWebhook_Update(t *testing.T) {
+	wh := &Webhook{Secret: "secret", updates: make(chan tgbotapi.Update, 1)}
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"update_id":42,"message":{"text":"/list"}}`))
+	req.Header.Set(webhookSecretHeader, "secret")
+
+	rsp := httptest.NewRecorder()
+	wh.ServeHTTP(rsp, req)
+
+	if rsp.Code != http.StatusOK {
+		t.Errorf("Expected %d status, but was %d", http.StatusOK, rsp.Code)
+	}
+
+	upd := <-wh.updates
+	if upd.UpdateID != 42 || upd.Message == nil || upd.Message.Text != "/list" {
+		t.Errorf("Expected update 42 with '/list' message, but was %+v", upd)
+	}
+}
+
+func TestWebhook_StoppedQueue(t *testing.T) {
+	wh := &Webhook{updates: make(chan tgbotapi.Update), stop: make(chan interface{})}
+	close(wh.stop)
+
+	rsp := httptest.NewRecorder()
+	wh.ServeHTTP(rsp, httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"update_id":1}`)))
+
+	if rsp.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d status, but was %d", http.StatusServiceUnavailable, rsp.Code)
+	}
+}
+
+func TestWebhook_StartBusyAddress(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer busy.Close()
+
+	wh := &Webhook{URL: "https://example.com/hook", Listen: busy.Addr().String()}
+	if _, err = wh.Start(); err == nil {
+		t.Errorf("Expected error for busy address")
+	}
+}
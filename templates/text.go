@@ -2,31 +2,102 @@ package templates
 
 import (
 	"bytes"
+	"embed"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
 	"strings"
 	"text/template"
 )
 
+// DefaultLang is used when user language is not supported
+const DefaultLang = "en"
+
+//go:embed */*.txt
+var embedded embed.FS
+
 var langs []string = []string{"en", "ru"}
 var output func(lang string, name string, data interface{}) (string, error)
 
-// SetTemplateOutput set standard template generation
-func SetTemplateOutput() {
+// SetTemplateOutput parses all templates once and sets standard template generation.
+// Templates are embedded into the binary unless dir with the same structure is specified.
+func SetTemplateOutput(dir string) error {
+	var src fs.FS = embedded
+	if len(dir) > 0 {
+		src = os.DirFS(dir)
+	}
+
+	set, err := load(src)
+	if err != nil {
+		return err
+	}
+
 	output = func(lang string, name string, data interface{}) (string, error) {
 		loc := parseLang(lang)
-		tmpl, err := template.ParseFiles(fmt.Sprintf("templates/%s/%s.txt", loc, name))
-		if err != nil {
-			return "", fmt.Errorf("error on '%s/%s' template loading, %s", loc, name, err)
+		tmpl, ok := set[loc][name]
+		if !ok {
+			return "", fmt.Errorf("error on '%s/%s' template loading, template not found", loc, name)
 		}
 
 		var tpl bytes.Buffer
-		err = tmpl.Execute(&tpl, data)
+		err := tmpl.Execute(&tpl, data)
 		if err != nil {
 			return "", fmt.Errorf("error on '%s/%s' template executing, %s", loc, name, err)
 		}
 
 		return tpl.String(), nil
 	}
+
+	return nil
+}
+
+// load parses templates of all languages and checks that every language has the same templates as default one
+func load(src fs.FS) (map[string]map[string]*template.Template, error) {
+	set := make(map[string]map[string]*template.Template)
+	for _, lang := range langs {
+		files, err := fs.Glob(src, lang+"/*.txt")
+		if err != nil {
+			return nil, err
+		}
+
+		set[lang] = make(map[string]*template.Template)
+		for _, file := range files {
+			name := strings.TrimSuffix(path.Base(file), ".txt")
+			raw, err := fs.ReadFile(src, file)
+			if err != nil {
+				return nil, fmt.Errorf("error on '%s/%s' template loading, %s", lang, name, err)
+			}
+
+			tmpl, err := template.New(name).Parse(string(raw))
+			if err != nil {
+				return nil, fmt.Errorf("error on '%s/%s' template parsing, %s", lang, name, err)
+			}
+
+			set[lang][name] = tmpl
+		}
+	}
+
+	if len(set[DefaultLang]) == 0 {
+		return nil, fmt.Errorf("no templates found for '%s' language", DefaultLang)
+	}
+
+	var missing []string
+	for name := range set[DefaultLang] {
+		for _, lang := range langs {
+			if _, ok := set[lang][name]; !ok {
+				missing = append(missing, lang+"/"+name)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing templates: %s", strings.Join(missing, ", "))
+	}
+
+	return set, nil
 }
 
 // SetCustomOutput set custom output generation
@@ -44,13 +115,27 @@ func ToTextW(lang string, name string, data interface{}) (string, error) {
 	return output(lang, name, data)
 }
 
-func parseLang(lang string) string {
+// Languages returns list of supported languages
+func Languages() []string {
+	return langs
+}
+
+// Supported checks if templates are available for the language
+func Supported(lang string) bool {
 	loc := strings.ToLower(lang)
 	for _, name := range langs {
 		if name == loc {
-			return loc
+			return true
 		}
 	}
 
-	return "en"
+	return false
+}
+
+func parseLang(lang string) string {
+	if Supported(lang) {
+		return strings.ToLower(lang)
+	}
+
+	return DefaultLang
 }
@@ -1,6 +1,10 @@
 package templates
 
-import "testing"
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
 
 func TestParseLang_WithKnownLang(t *testing.T) {
 	exp := "ru"
@@ -17,3 +21,80 @@ func TestParseLang_WithUnknownLang(t *testing.T) {
 		t.Errorf("Expected '%s', but was '%s'", exp, r)
 	}
 }
+
+func TestSupported(t *testing.T) {
+	if !Supported("RU") {
+		t.Errorf("Expected 'RU' to be supported")
+	}
+
+	if Supported("unknown") {
+		t.Errorf("Expected 'unknown' to be not supported")
+	}
+}
+
+func TestSetTemplateOutput_Embedded(t *testing.T) {
+	defer SetCustomOutput(nil)
+
+	if err := SetTemplateOutput(""); err != nil {
+		t.Fatalf("Error not expected, but was: %s", err)
+	}
+
+	r, err := ToText("RU", "help-success")
+	if err != nil || len(r) == 0 {
+		t.Errorf("Expected help text, but was '%s' with error %v", r, err)
+	}
+
+	if _, err = ToText("en", "unknown"); err == nil {
+		t.Errorf("Expected error on unknown template")
+	}
+}
+
+func TestFeedBroken_EscapesError(t *testing.T) {
+	defer SetCustomOutput(nil)
+
+	if err := SetTemplateOutput(""); err != nil {
+		t.Fatalf("Error not expected, but was: %s", err)
+	}
+
+	for _, lang := range Languages() {
+		r, err := ToTextW(lang, "feed-broken", struct {
+			Name      string
+			Failures  int
+			LastError string
+		}{"test", 1, "unexpected <html> tag"})
+		if err != nil || !strings.Contains(r, "&lt;html&gt;") {
+			t.Errorf("Expected escaped error for '%s', but was '%s' with error %v", lang, r, err)
+		}
+	}
+}
+
+func TestLoad_MissingTemplate(t *testing.T) {
+	src := fstest.MapFS{
+		"en/a.txt": {Data: []byte("a")},
+		"en/b.txt": {Data: []byte("b")},
+		"ru/a.txt": {Data: []byte("a")},
+	}
+
+	_, err := load(src)
+	if err == nil || !strings.Contains(err.Error(), "ru/b") {
+		t.Errorf("Expected missing 'ru/b' template error, but was %v", err)
+	}
+}
+
+func TestLoad_BrokenTemplate(t *testing.T) {
+	src := fstest.MapFS{
+		"en/a.txt": {Data: []byte("a")},
+		"ru/a.txt": {Data: []byte("{{.Name")},
+	}
+
+	_, err := load(src)
+	if err == nil || !strings.Contains(err.Error(), "ru/a") {
+		t.Errorf("Expected parsing error of 'ru/a' template, but was %v", err)
+	}
+}
+
+func TestLoad_NoTemplates(t *testing.T) {
+	if _, err := load(fstest.MapFS{}); err == nil {
+		t.Errorf("Expected error when no templates found")
+	}
+}